@@ -4,7 +4,9 @@ go 1.20
 
 require (
 	github.com/aws/aws-sdk-go v1.44.114
+	github.com/glebarez/go-sqlite v1.19.1
 	github.com/glebarez/sqlite v1.5.0
+	github.com/go-sql-driver/mysql v1.6.0
 	github.com/gorilla/handlers v1.5.1
 	github.com/gorilla/mux v1.8.0
 	github.com/rancher/wrangler v1.0.1
@@ -15,14 +17,13 @@ require (
 	gorm.io/driver/mysql v1.4.1
 	gorm.io/gorm v1.24.0
 	k8s.io/apimachinery v0.25.2
+	modernc.org/sqlite v1.19.1
 )
 
 require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.2 // indirect
 	github.com/felixge/httpsnoop v1.0.3 // indirect
-	github.com/glebarez/go-sqlite v1.19.1 // indirect
 	github.com/go-logr/logr v1.2.3 // indirect
-	github.com/go-sql-driver/mysql v1.6.0 // indirect
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
@@ -37,5 +38,4 @@ require (
 	modernc.org/libc v1.20.3 // indirect
 	modernc.org/mathutil v1.5.0 // indirect
 	modernc.org/memory v1.4.0 // indirect
-	modernc.org/sqlite v1.19.1 // indirect
 )
@@ -0,0 +1,120 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The handlers in this file implement the API of acme-dns (https://github.com/joohoi/acme-dns), so that ACME clients
+// with acme-dns support can solve DNS-01 challenges with acorn-dns. A registration is an ordinary domain: the username is
+// the domain's name, the password is its token and the challenge TXT record is the _acme-challenge record of the domain.
+// Clients then CNAME the _acme-challenge record of the name they want a certificate for to the returned fulldomain.
+// Registrations never expire, but each update still renews them, so that their last check-in stays meaningful.
+
+func (h *handler) acmeDNSRegister(w http.ResponseWriter, r *http.Request) {
+	var input model.ACMEDNSRegisterRequest
+	// acme-dns allows registering without a body
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&input); err != nil {
+			writeACMEDNSError(w, http.StatusBadRequest, "malformed_json_payload")
+			return
+		}
+	}
+
+	// Silently ignoring the client's source restrictions would leave the registration more open than it asked for
+	if len(input.AllowFrom) > 0 {
+		writeACMEDNSError(w, http.StatusBadRequest, "allowfrom_not_supported")
+		return
+	}
+
+	// Registrations never expire, since acme-dns clients only update them when they renew their certificates, which is
+	// less often than domains expire
+	domain, err := h.backend.CreateDomain("", "", "", true, actorFromRequest(r))
+	if err != nil {
+		logrus.Errorf("failed to create domain for acme-dns registration: %v", err)
+		writeACMEDNSError(w, http.StatusInternalServerError, "db_error")
+		return
+	}
+
+	name := strings.TrimPrefix(domain.Name, ".")
+	writeSuccess(w, http.StatusCreated, model.ACMEDNSRegisterResponse{
+		Username:   name,
+		Password:   domain.Token,
+		FullDomain: "_acme-challenge." + name,
+		SubDomain:  strings.Split(name, ".")[0],
+		AllowFrom:  []string{},
+	})
+}
+
+func (h *handler) acmeDNSUpdate(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("X-Api-User")
+	key := r.Header.Get("X-Api-Key")
+	if username == "" || key == "" {
+		writeACMEDNSError(w, http.StatusUnauthorized, "forbidden")
+		return
+	}
+
+	var input model.ACMEDNSUpdateRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&input); err != nil {
+		writeACMEDNSError(w, http.StatusBadRequest, "malformed_json_payload")
+		return
+	}
+
+	domainName := "." + username
+	domain, err := h.backend.GetDomain(domainName)
+	if err != nil {
+		logrus.Errorf("failed to get domain from DB for %v, err: %v", domainName, err)
+		writeACMEDNSError(w, http.StatusInternalServerError, "db_error")
+		return
+	}
+	if domain.ID == 0 || domain.TokenHash == "" || domain.UniqueSlug != input.SubDomain {
+		writeACMEDNSError(w, http.StatusUnauthorized, "forbidden")
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(domain.TokenHash), []byte(key)); err != nil {
+		writeACMEDNSError(w, http.StatusUnauthorized, "forbidden")
+		return
+	}
+
+	challenge := model.ACMEChallengeRequest{Value: input.TXT}
+	if err := validateACMEChallenge(challenge); err != nil {
+		writeACMEDNSError(w, http.StatusBadRequest, "bad_txt")
+		return
+	}
+
+	actor := actorFromRequest(r)
+	actor.TokenID = model.TokenID(key)
+
+	// acme-dns clients never renew their registrations, so each update does. This also reclaims registrations made
+	// before they stopped expiring that have since been suspended.
+	if _, err := h.backend.Renew(domain.Domain, domain.ID, nil, domain.Version, actor); err != nil {
+		logrus.Errorf("failed to renew acme-dns registration %v, err: %v", domainName, err)
+		writeACMEDNSError(w, http.StatusInternalServerError, "db_error")
+		return
+	}
+
+	// acme-dns returns as soon as the record is written and clients poll for propagation themselves, so don't wait here
+	if _, err := h.backend.AddACMEChallenge(domain.Domain, domain.ID, challenge, false, actor); err != nil {
+		logrus.Errorf("failed to add acme-dns challenge for %v, err: %v", domainName, err)
+		writeACMEDNSError(w, http.StatusInternalServerError, "db_error")
+		return
+	}
+
+	writeSuccess(w, http.StatusOK, model.ACMEDNSUpdateResponse{TXT: input.TXT})
+}
+
+// writeACMEDNSError writes an error in the format acme-dns clients expect
+func writeACMEDNSError(w http.ResponseWriter, httpStatus int, message string) {
+	res, _ := json.Marshal(model.ACMEDNSErrorResponse{Error: message})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	_, _ = w.Write(res)
+}
@@ -0,0 +1,216 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/acorn-io/acorn-dns/pkg/backend"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/acorn-io/acorn-dns/pkg/policy"
+	"github.com/gorilla/mux"
+)
+
+// The handlers in this file serve the admin API, which operators use to manage domains. They authenticate with the
+// admin token rather than a domain's token.
+
+func (h *handler) getDomainQuota(w http.ResponseWriter, r *http.Request) {
+	domainName := mux.Vars(r)["domain"]
+
+	d, err := h.backend.GetDomain(domainName)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if d.ID == 0 {
+		handleBackendError(w, fmt.Errorf("%w: domain %v", backend.ErrNotFound, domainName))
+		return
+	}
+
+	quota, err := h.backend.GetDomainQuota(d, true)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeSuccess(w, http.StatusOK, quota)
+}
+
+func (h *handler) setDomainQuota(w http.ResponseWriter, r *http.Request) {
+	var input model.DomainQuotaOverride
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&input)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	for _, limit := range []*int64{input.MaxRecords, input.MaxValuesPerRecord, input.MaxMutationsPerMinute} {
+		if limit != nil && *limit < 0 {
+			handleError(w, http.StatusUnprocessableEntity, fmt.Errorf("quota limits must not be negative"))
+			return
+		}
+	}
+
+	quota, err := h.backend.SetDomainQuotaOverride(mux.Vars(r)["domain"], input)
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+
+	writeSuccess(w, http.StatusOK, quota)
+}
+
+func (h *handler) restoreDomain(w http.ResponseWriter, r *http.Request) {
+	domain, err := h.backend.RestoreDomain(mux.Vars(r)["domain"], actorFromRequest(r))
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+
+	writeSuccess(w, http.StatusOK, domain)
+}
+
+func (h *handler) getNameRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.backend.GetNameRules()
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeSuccess(w, http.StatusOK, rules)
+}
+
+func (h *handler) createNameRule(w http.ResponseWriter, r *http.Request) {
+	var input model.NameRule
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&input)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := policy.Validate(input); err != nil {
+		handleError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	rule, err := h.backend.CreateNameRule(input)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeSuccess(w, http.StatusCreated, rule)
+}
+
+func (h *handler) deleteNameRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["rule"], 10, 64)
+	if err != nil {
+		handleError(w, http.StatusNotFound, fmt.Errorf("name rule %v doesn't exist", mux.Vars(r)["rule"]))
+		return
+	}
+
+	if err := h.backend.DeleteNameRule(uint(id)); err != nil {
+		handleBackendError(w, err)
+		return
+	}
+}
+
+func (h *handler) getInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := h.backend.GetInvitations()
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeSuccess(w, http.StatusOK, invitations)
+}
+
+func (h *handler) createInvitation(w http.ResponseWriter, r *http.Request) {
+	var input model.InvitationRequest
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&input); err != nil && err != io.EOF {
+			handleError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if input.Uses < 0 {
+		handleError(w, http.StatusUnprocessableEntity, fmt.Errorf("uses must not be negative"))
+		return
+	}
+	if input.Uses == 0 {
+		input.Uses = 1
+	}
+
+	invitation, err := h.backend.CreateInvitation(input.Uses)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeSuccess(w, http.StatusCreated, invitation)
+}
+
+func (h *handler) deleteInvitation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["invitation"], 10, 64)
+	if err != nil {
+		handleError(w, http.StatusNotFound, fmt.Errorf("invitation %v doesn't exist", mux.Vars(r)["invitation"]))
+		return
+	}
+
+	if err := h.backend.DeleteInvitation(uint(id)); err != nil {
+		handleBackendError(w, err)
+		return
+	}
+}
+
+func (h *handler) getZoneDNSSEC(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.backend.GetZoneDNSSEC(mux.Vars(r)["zone"])
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+	writeSuccess(w, http.StatusOK, resp)
+}
+
+func (h *handler) enableZoneDNSSEC(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.backend.EnableZoneDNSSEC(mux.Vars(r)["zone"])
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+	writeSuccess(w, http.StatusOK, resp)
+}
+
+func (h *handler) disableZoneDNSSEC(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.backend.DisableZoneDNSSEC(mux.Vars(r)["zone"])
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+	writeSuccess(w, http.StatusOK, resp)
+}
+
+func (h *handler) rotateZoneKeySigningKey(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.backend.RotateZoneKeySigningKey(mux.Vars(r)["zone"])
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+	writeSuccess(w, http.StatusCreated, resp)
+}
+
+func (h *handler) deleteZoneKeySigningKey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	resp, err := h.backend.DeleteZoneKeySigningKey(vars["zone"], vars["key"])
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+	writeSuccess(w, http.StatusOK, resp)
+}
@@ -0,0 +1,45 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// getAuditLog serves both a domain's own audit log and, in the admin API, the whole audit log, which can be narrowed
+// down to a domain by name with the domain query parameter. Pages are selected with the limit and before parameters,
+// where before is the next cursor of the previous page.
+func (h *handler) getAuditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	domainID := domainIDFromContext(r.Context())
+	var domainName string
+	if domainID == 0 {
+		domainName = query.Get("domain")
+	}
+
+	var (
+		beforeID uint64
+		limit    int
+		err      error
+	)
+	if before := query.Get("before"); before != "" {
+		if beforeID, err = strconv.ParseUint(before, 10, 64); err != nil {
+			handleError(w, http.StatusUnprocessableEntity, fmt.Errorf("before must be the cursor of a page"))
+			return
+		}
+	}
+	if l := query.Get("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+			handleError(w, http.StatusUnprocessableEntity, fmt.Errorf("limit must be a positive number"))
+			return
+		}
+	}
+
+	resp, err := h.backend.GetAuditLog(domainID, domainName, uint(beforeID), limit)
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+	writeSuccess(w, http.StatusOK, resp)
+}
@@ -2,11 +2,13 @@ package apiserver
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/acorn-io/acorn-dns/pkg/backend"
+	"github.com/acorn-io/acorn-dns/pkg/model"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
@@ -14,7 +16,13 @@ import (
 
 type ContextKey string
 
-const DomainID ContextKey = "domainID"
+const (
+	DomainID ContextKey = "domainID"
+	// TokenID identifies the token a request was authenticated with, for the audit log
+	TokenID ContextKey = "tokenID"
+	// DomainSuspended is set for domains in their grace period
+	DomainSuspended ContextKey = "domainSuspended"
+)
 
 func tokenAuthMiddleware(b backend.Backend) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -56,12 +64,55 @@ func tokenAuthMiddleware(b backend.Backend) func(http.Handler) http.Handler {
 			}
 
 			ctx := context.WithValue(r.Context(), DomainID, domain.ID)
+			ctx = context.WithValue(ctx, DomainSuspended, domain.SuspendedAt != nil)
+			ctx = context.WithValue(ctx, TokenID, model.TokenID(token))
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// gracePeriodMiddleware only lets domains in their grace period be read or renewed. Their records have been removed
+// from their zone, so changes have to wait until the domain is reclaimed by renewing it.
+func gracePeriodMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suspended, _ := r.Context().Value(DomainSuspended).(bool)
+		if suspended && r.Method != http.MethodGet {
+			template, _ := mux.CurrentRoute(r).GetPathTemplate()
+			if !strings.HasSuffix(template, "/renew") {
+				writeErrorResponse(w, http.StatusConflict, "Domain has expired and must be renewed before it can be changed", nil)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminAuthMiddleware authenticates operators, who use the admin token instead of a domain's token
+func adminAuthMiddleware(adminToken string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+				writeErrorResponse(w, http.StatusUnauthorized, "Authentication failed", nil)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), TokenID, model.AdminTokenID)))
+		})
+	}
+}
+
 func domainIDFromContext(ctx context.Context) uint {
 	domainID, _ := ctx.Value(DomainID).(uint)
 	return domainID
 }
+
+// actorFromRequest identifies who made the request for the audit log
+func actorFromRequest(r *http.Request) model.Actor {
+	tokenID, _ := r.Context().Value(TokenID).(string)
+	return model.Actor{
+		TokenID:    tokenID,
+		RemoteIP:   clientIP(r),
+		RemoteAddr: remoteHost(r),
+		UserAgent:  r.UserAgent(),
+	}
+}
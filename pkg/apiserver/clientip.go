@@ -0,0 +1,93 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP is the address of the client that made a request, as determined by clientIPMiddleware
+const ClientIP ContextKey = "clientIP"
+
+// parseTrustedProxies parses the addresses and CIDR ranges of the proxies whose X-Forwarded-For headers are believed
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %v", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %v: %v", proxy, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// clientIPMiddleware determines the address of the client that made each request, which the rate limits and the audit
+// log rely on. Clients can send any X-Forwarded-For header they like, so it's only believed when the request comes from
+// a trusted proxy, and then only as far back as the chain of trusted proxies goes.
+func clientIPMiddleware(trustedProxies []*net.IPNet) func(http.Handler) http.Handler {
+	trusted := func(addr string) bool {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return false
+		}
+		for _, n := range trustedProxies {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := remoteHost(r)
+			if trusted(ip) {
+				hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+				for i := len(hops) - 1; i >= 0; i-- {
+					hop := strings.TrimSpace(hops[i])
+					if net.ParseIP(hop) == nil {
+						break
+					}
+					ip = hop
+					if !trusted(hop) {
+						break
+					}
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ClientIP, ip)))
+		})
+	}
+}
+
+// clientIP returns the address of the client that made the request
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(ClientIP).(string); ok {
+		return ip
+	}
+	return remoteHost(r)
+}
+
+// remoteHost returns the address the request's connection came from
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
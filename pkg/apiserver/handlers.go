@@ -2,7 +2,9 @@ package apiserver
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"strings"
@@ -38,18 +40,85 @@ func (h *handler) getDomain(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeSuccess(w, http.StatusOK, model.DomainResponse{Name: d.Domain})
+	quota, err := h.backend.GetDomainQuota(d, false)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	etag := model.ETag(d.Revision)
+	w.Header().Set("ETag", etag)
+	writeSuccess(w, http.StatusOK, model.DomainResponse{Name: d.Domain, Zone: d.Zone, ETag: etag, Quota: &quota,
+		Expiry: h.backend.DomainExpiry(d)})
 }
 
 func (h *handler) createDomain(w http.ResponseWriter, r *http.Request) {
-	domain, err := h.backend.CreateDomain()
+	var input model.DomainRequest
+	// The body is optional, since it's only needed to request a slug or zone
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&input); err != nil && err != io.EOF {
+			handleError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	domain, err := h.backend.CreateDomain(input.Zone, input.Slug, r.Header.Get("X-Invitation-Code"), false, actorFromRequest(r))
 	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+	writeSuccess(w, http.StatusCreated, domain)
+}
+
+func (h *handler) registerCustomDomain(w http.ResponseWriter, r *http.Request) {
+	var input model.CustomDomainRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&input); err != nil {
 		handleError(w, http.StatusInternalServerError, err)
 		return
 	}
+
+	resp, err := h.backend.RegisterCustomDomain(input.Name)
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+	writeSuccess(w, http.StatusCreated, resp)
+}
+
+// verifyCustomDomain is authenticated with the token the custom domain was registered with, which the domain keeps once
+// it's created
+func (h *handler) verifyCustomDomain(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	actor := actorFromRequest(r)
+	actor.TokenID = model.TokenID(token)
+	domain, err := h.backend.VerifyCustomDomain(name, token, actor)
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
 	writeSuccess(w, http.StatusCreated, domain)
 }
 
+func (h *handler) getZones(w http.ResponseWriter, r *http.Request) {
+	writeSuccess(w, http.StatusOK, h.backend.GetZones())
+}
+
+func (h *handler) slugAvailability(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+
+	resp, err := h.backend.SlugAvailability(slug, r.Header.Get("X-Invitation-Code"))
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+
+	writeSuccess(w, http.StatusOK, resp)
+}
+
 func (h *handler) renew(w http.ResponseWriter, r *http.Request) {
 	var input model.RenewRequest
 	decoder := json.NewDecoder(r.Body)
@@ -63,7 +132,7 @@ func (h *handler) renew(w http.ResponseWriter, r *http.Request) {
 	domainName := vars["domain"]
 	domainID := domainIDFromContext(r.Context())
 
-	outOfSync, err := h.backend.Renew(domainName, domainID, input.Records, input.Version)
+	outOfSync, err := h.backend.Renew(domainName, domainID, input.Records, input.Version, actorFromRequest(r))
 	if err != nil {
 		handleError(w, http.StatusInternalServerError, err)
 		return
@@ -81,7 +150,7 @@ func (h *handler) purgerecords(w http.ResponseWriter, r *http.Request) {
 	domainName := vars["domain"]
 	domainID := domainIDFromContext(r.Context())
 
-	err := h.backend.PurgeRecords(domainName, domainID)
+	err := h.backend.PurgeRecords(domainName, domainID, actorFromRequest(r))
 	if err != nil {
 		handleError(w, http.StatusInternalServerError, err)
 		return
@@ -93,6 +162,39 @@ func (h *handler) purgerecords(w http.ResponseWriter, r *http.Request) {
 	writeSuccess(w, http.StatusAccepted, resp)
 }
 
+func (h *handler) syncRecords(w http.ResponseWriter, r *http.Request) {
+	if rejectPrecondition(w, r) {
+		return
+	}
+
+	var input model.RecordSyncRequest
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&input)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	for _, record := range input.Records {
+		if err := validateRecord(record); err != nil {
+			handleError(w, http.StatusUnprocessableEntity, fmt.Errorf("record %v: %w", record.Name, err))
+			return
+		}
+	}
+
+	vars := mux.Vars(r)
+	domainName := vars["domain"]
+	domainID := domainIDFromContext(r.Context())
+
+	resp, err := h.backend.SyncRecords(domainName, domainID, input.Records, input.Version, actorFromRequest(r))
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+
+	writeSuccess(w, http.StatusOK, resp)
+}
+
 func (h *handler) createRecord(w http.ResponseWriter, r *http.Request) {
 
 	var input model.RecordRequest
@@ -112,26 +214,295 @@ func (h *handler) createRecord(w http.ResponseWriter, r *http.Request) {
 	domain := vars["domain"]
 	domainID := domainIDFromContext(r.Context())
 
-	record, err := h.backend.CreateRecord(domain, domainID, input)
+	record, err := h.backend.CreateRecord(domain, domainID, input, preconditionFromRequest(r), actorFromRequest(r))
 	if err != nil {
-		handleError(w, http.StatusInternalServerError, err)
+		handleBackendError(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", record.ETag)
 	writeSuccess(w, http.StatusCreated, record)
 }
 
+func (h *handler) updateRecordValues(w http.ResponseWriter, r *http.Request) {
+	var input model.RecordValuesRequest
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&input)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	domain := vars["domain"]
+	record := vars["record"]
+	domainID := domainIDFromContext(r.Context())
+
+	if err := validateRecordValues(record, input); err != nil {
+		handleError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	resp, err := h.backend.UpdateRecordValues(domain, domainID, record, input, preconditionFromRequest(r), actorFromRequest(r))
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+
+	if resp.ETag != "" {
+		w.Header().Set("ETag", resp.ETag)
+	}
+	writeSuccess(w, http.StatusOK, resp)
+}
+
+func (h *handler) batchRecords(w http.ResponseWriter, r *http.Request) {
+	if rejectPrecondition(w, r) {
+		return
+	}
+
+	var input model.RecordBatchRequest
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&input)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	domain := vars["domain"]
+	domainID := domainIDFromContext(r.Context())
+
+	errs := make([]error, len(input.Operations))
+	var invalid bool
+	for i, op := range input.Operations {
+		if op.Action == model.BatchActionDelete {
+			if op.Name == "" {
+				errs[i] = fmt.Errorf("%w: record name must be provided", backend.ErrInvalidRecord)
+			}
+		} else if err := validateRecord(op.RecordRequest); err != nil {
+			errs[i] = fmt.Errorf("%w: %v", backend.ErrInvalidRecord, err)
+		}
+		invalid = invalid || errs[i] != nil
+	}
+	if invalid {
+		writeBatchError(w, input.Operations, &backend.BatchError{Errors: errs})
+		return
+	}
+
+	results, err := h.backend.ApplyRecordBatch(domain, domainID, input.Operations, actorFromRequest(r))
+	var batchErr *backend.BatchError
+	if errors.As(err, &batchErr) {
+		writeBatchError(w, input.Operations, batchErr)
+		return
+	} else if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+
+	for i := range results {
+		results[i].Status = http.StatusOK
+		if results[i].Action == model.BatchActionCreate {
+			results[i].Status = http.StatusCreated
+		}
+	}
+	writeSuccess(w, http.StatusOK, model.RecordBatchResponse{Results: results})
+}
+
+// writeBatchError writes the result of every operation of a batch that wasn't applied. The operations that were valid
+// get a 424 (Failed Dependency) status, since they weren't applied only because others were invalid.
+func writeBatchError(w http.ResponseWriter, ops []model.RecordBatchOperation, batchErr *backend.BatchError) {
+	status := http.StatusUnprocessableEntity
+	var statusSet bool
+	results := make([]model.RecordBatchResult, len(ops))
+	for i, op := range ops {
+		results[i].Action = op.Action
+		if err := batchErr.Errors[i]; err != nil {
+			results[i].Status = statusForBackendError(err)
+			results[i].Error = err.Error()
+			if !statusSet {
+				// The response's status is that of the first failed operation
+				status = results[i].Status
+				statusSet = true
+			}
+		} else {
+			results[i].Status = http.StatusFailedDependency
+		}
+	}
+
+	writeErrorResponse(w, status, batchErr.Error(), model.RecordBatchResponse{Results: results})
+}
+
+func (h *handler) getRecord(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	domain := vars["domain"]
+	record := vars["record"]
+	domainID := domainIDFromContext(r.Context())
+	// A record is identified by its type, along with its set identifier if it has a routing policy
+	rType := r.URL.Query().Get("type")
+	setIdentifier := r.URL.Query().Get("setIdentifier")
+	if rType == "" {
+		handleError(w, http.StatusUnprocessableEntity, fmt.Errorf("type must be provided"))
+		return
+	}
+
+	resp, err := h.backend.GetRecord(record, domain, domainID, rType, setIdentifier)
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", resp.ETag)
+	writeSuccess(w, http.StatusOK, resp)
+}
+
 func (h *handler) deleteRecord(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	domain := vars["domain"]
 	record := vars["record"]
 	domainID := domainIDFromContext(r.Context())
+	// Optionally restrict the delete to the record sets with this type and set identifier. Without them, every record
+	// set for the record is deleted.
+	rType := r.URL.Query().Get("type")
+	setIdentifier := r.URL.Query().Get("setIdentifier")
+
+	err := h.backend.DeleteRecord(record, domain, domainID, rType, setIdentifier, preconditionFromRequest(r), actorFromRequest(r))
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+}
+
+// preconditionFromRequest returns the conditions of the request's If-Match and If-None-Match headers
+func preconditionFromRequest(r *http.Request) model.Precondition {
+	return model.Precondition{
+		IfMatch:     r.Header.Get("If-Match"),
+		IfNoneMatch: r.Header.Get("If-None-Match"),
+	}
+}
+
+// rejectPrecondition writes an error and returns true if the request has a precondition. It's for requests that change
+// several records, which a single entity tag can't describe.
+func rejectPrecondition(w http.ResponseWriter, r *http.Request) bool {
+	if preconditionFromRequest(r) == (model.Precondition{}) {
+		return false
+	}
+	handleError(w, http.StatusBadRequest, fmt.Errorf("If-Match and If-None-Match are only supported on requests that change a single record"))
+	return true
+}
+
+func (h *handler) createHealthCheck(w http.ResponseWriter, r *http.Request) {
+	var input model.HealthCheckRequest
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&input)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := validateHealthCheck(input); err != nil {
+		handleError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	domain := vars["domain"]
+	domainID := domainIDFromContext(r.Context())
+
+	healthCheck, err := h.backend.CreateHealthCheck(domain, domainID, input)
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+
+	writeSuccess(w, http.StatusCreated, healthCheck)
+}
+
+func (h *handler) getHealthChecks(w http.ResponseWriter, r *http.Request) {
+	domainID := domainIDFromContext(r.Context())
 
-	err := h.backend.DeleteRecord(record, domain, domainID)
+	healthChecks, err := h.backend.GetHealthChecks(domainID)
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+
+	writeSuccess(w, http.StatusOK, healthChecks)
+}
+
+func (h *handler) getHealthCheck(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["healthcheck"]
+	domainID := domainIDFromContext(r.Context())
+
+	healthCheck, err := h.backend.GetHealthCheck(domainID, id)
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+
+	writeSuccess(w, http.StatusOK, healthCheck)
+}
+
+func (h *handler) deleteHealthCheck(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["healthcheck"]
+	domainID := domainIDFromContext(r.Context())
+
+	if err := h.backend.DeleteHealthCheck(domainID, id); err != nil {
+		handleBackendError(w, err)
+		return
+	}
+}
+
+func (h *handler) addACMEChallenge(w http.ResponseWriter, r *http.Request) {
+	var input model.ACMEChallengeRequest
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&input)
+	if err != nil {
+		handleError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := validateACMEChallenge(input); err != nil {
+		handleError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	domain := vars["domain"]
+	domainID := domainIDFromContext(r.Context())
+
+	record, err := h.backend.AddACMEChallenge(domain, domainID, input, true, actorFromRequest(r))
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+
+	writeSuccess(w, http.StatusCreated, record)
+}
+
+func (h *handler) removeACMEChallenge(w http.ResponseWriter, r *http.Request) {
+	var input model.ACMEChallengeRequest
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&input)
 	if err != nil {
 		handleError(w, http.StatusInternalServerError, err)
 		return
 	}
+
+	if err := validateACMEChallenge(input); err != nil {
+		handleError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	domain := vars["domain"]
+	domainID := domainIDFromContext(r.Context())
+
+	if err := h.backend.RemoveACMEChallenge(domain, domainID, input, actorFromRequest(r)); err != nil {
+		handleBackendError(w, err)
+		return
+	}
 }
 
 func validateRecord(input model.RecordRequest) error {
@@ -143,10 +514,38 @@ func validateRecord(input model.RecordRequest) error {
 		return fmt.Errorf("record name must be provided")
 	}
 
+	if input.Type == model.RecordTypeAlias {
+		if input.AliasTarget == nil {
+			return fmt.Errorf("alias records must have an alias target")
+		}
+		if len(input.Values) != 0 {
+			return fmt.Errorf("alias records can't have values")
+		}
+		if input.AliasTarget.HostedZoneID == "" {
+			return fmt.Errorf("alias target hosted zone ID must be provided")
+		}
+		if err := model.ValidateHostname(input.AliasTarget.DNSName); err != nil {
+			return fmt.Errorf("alias target DNS name is invalid: %v", err)
+		}
+		return validateRoutingPolicy(input.RoutingPolicy)
+	}
+
+	if input.AliasTarget != nil {
+		return fmt.Errorf("only alias records can have an alias target")
+	}
+
 	if len(input.Values) == 0 {
 		return fmt.Errorf("must supply at least one value")
 	}
 
+	if input.TTL < 0 {
+		return fmt.Errorf("ttl must not be negative")
+	}
+
+	if err := validateRoutingPolicy(input.RoutingPolicy); err != nil {
+		return err
+	}
+
 	// This could be overkill if we assume that k8s's ingress logic is validating this for us
 	switch input.Type {
 	case model.RecordTypeA:
@@ -167,6 +566,135 @@ func validateRecord(input model.RecordRequest) error {
 		if len(input.Values) != 1 {
 			return fmt.Errorf("cname records must contain exactly one value. this contains %v values", len(input.Values))
 		}
+	case model.RecordTypeMx:
+		for _, v := range input.Values {
+			if _, err := model.ParseMXValue(v); err != nil {
+				return fmt.Errorf("value %v is not a valid MX value: %v", v, err)
+			}
+		}
+	case model.RecordTypeSrv:
+		for _, v := range input.Values {
+			if _, err := model.ParseSRVValue(v); err != nil {
+				return fmt.Errorf("value %v is not a valid SRV value: %v", v, err)
+			}
+		}
+	case model.RecordTypeCaa:
+		for _, v := range input.Values {
+			if _, err := model.ParseCAAValue(v); err != nil {
+				return fmt.Errorf("value %v is not a valid CAA value: %v", v, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateRecordValues(name string, input model.RecordValuesRequest) error {
+	if input.Type == model.RecordTypeAlias {
+		return fmt.Errorf("alias records have no values")
+	}
+
+	if len(input.Add) == 0 && len(input.Remove) == 0 {
+		return fmt.Errorf("must supply at least one value to add or remove")
+	}
+
+	if len(input.Add) == 0 {
+		return model.IsValidRecordType(input.Type)
+	}
+
+	// The added values must be valid for the record's type, the same as when creating a record
+	return validateRecord(model.RecordRequest{
+		Name:   name,
+		Type:   input.Type,
+		Values: input.Add,
+	})
+}
+
+func validateRoutingPolicy(policy *model.RoutingPolicy) error {
+	if policy == nil {
+		return nil
+	}
+
+	// Route53's limit on set identifiers
+	if policy.SetIdentifier == "" || len(policy.SetIdentifier) > 128 {
+		return fmt.Errorf("routing policy set identifier must be between 1 and 128 characters")
+	}
+
+	switch policy.Type {
+	case model.RoutingPolicyWeighted:
+		if policy.Weight < 0 || policy.Weight > 255 {
+			return fmt.Errorf("routing policy weight must be between 0 and 255")
+		}
+		if policy.Failover != "" {
+			return fmt.Errorf("weighted routing policies can't specify failover")
+		}
+	case model.RoutingPolicyFailover:
+		if policy.Failover != model.FailoverPrimary && policy.Failover != model.FailoverSecondary {
+			return fmt.Errorf("failover must be %v or %v", model.FailoverPrimary, model.FailoverSecondary)
+		}
+		if policy.Weight != 0 {
+			return fmt.Errorf("failover routing policies can't specify a weight")
+		}
+	default:
+		return fmt.Errorf("routing policy type must be %v or %v", model.RoutingPolicyWeighted, model.RoutingPolicyFailover)
+	}
+
+	return nil
+}
+
+func validateHealthCheck(input model.HealthCheckRequest) error {
+	if input.Record == "" {
+		return fmt.Errorf("record must be provided")
+	}
+
+	switch input.Type {
+	case model.HealthCheckTypeHTTP, model.HealthCheckTypeHTTPS:
+	case model.HealthCheckTypeTCP:
+		if input.Port == 0 {
+			return fmt.Errorf("port must be provided for TCP health checks")
+		}
+		if input.ResourcePath != "" {
+			return fmt.Errorf("TCP health checks can't have a resource path")
+		}
+	default:
+		return fmt.Errorf("health check type must be %v, %v or %v",
+			model.HealthCheckTypeHTTP, model.HealthCheckTypeHTTPS, model.HealthCheckTypeTCP)
+	}
+
+	if input.IPAddress != "" {
+		if ip := net.ParseIP(input.IPAddress); ip == nil || strings.Contains(input.IPAddress, ":") {
+			return fmt.Errorf("ip address %v is not a valid IPv4 address", input.IPAddress)
+		}
+	}
+
+	if input.Port < 0 || input.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535")
+	}
+
+	if input.ResourcePath != "" && !strings.HasPrefix(input.ResourcePath, "/") {
+		return fmt.Errorf("resource path must start with /")
+	}
+
+	// These are Route53's limits
+	if input.FailureThreshold < 0 || input.FailureThreshold > 10 {
+		return fmt.Errorf("failure threshold must be between 1 and 10")
+	}
+	if input.RequestInterval != 0 && input.RequestInterval != 10 && input.RequestInterval != 30 {
+		return fmt.Errorf("request interval must be 10 or 30 seconds")
+	}
+
+	return nil
+}
+
+func validateACMEChallenge(input model.ACMEChallengeRequest) error {
+	if input.Value == "" {
+		return fmt.Errorf("challenge value must be provided")
+	}
+
+	// TXT strings are limited to 255 characters. Challenge values are base64url encoded SHA-256 digests, so this is
+	// only a guard against garbage.
+	if len(input.Value) > 255 || strings.ContainsAny(input.Value, "\" \t\n") {
+		return fmt.Errorf("challenge value %v is invalid", input.Value)
 	}
 
 	return nil
@@ -0,0 +1,142 @@
+package apiserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/acorn-io/acorn-dns/pkg/backend"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/sirupsen/logrus"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// idempotencyMiddleware makes a handler safe to retry. When a request carries an Idempotency-Key header, the response is
+// stored and replayed for any retry of the same request with the same key, instead of handling it again. Reusing a key
+// for a different request is a conflict. Server errors aren't stored, so a request that failed that way can be retried.
+//
+// Keys are scoped to the method, the path and the client: the token of an authenticated request or, for creating a
+// domain, the client's address. Keys should still be random, such as UUIDs.
+//
+// If tokenBearing is set, the responses are a model.DomainResponse holding the new domain's token, which is never
+// stored. A retry of a request that succeeded is then a conflict naming the domain instead of a replay, since its token
+// can't be returned again. Being scoped by address, the key alone doesn't prove the retry comes from the same client.
+func idempotencyMiddleware(b backend.Backend, tokenBearing bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				handleError(w, http.StatusBadRequest, fmt.Errorf("Idempotency-Key must be at most %v characters", maxIdempotencyKeyLength))
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				handleError(w, http.StatusInternalServerError, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			sum := sha256.Sum256(body)
+			requestHash := hex.EncodeToString(sum[:])
+
+			scope := r.Method + " " + r.URL.Path
+			if tokenID, ok := r.Context().Value(TokenID).(string); ok {
+				scope += " token:" + tokenID
+			} else {
+				scope += " ip:" + clientIP(r)
+			}
+
+			saved, created, err := b.BeginIdempotentRequest(scope, key, requestHash)
+			if err != nil {
+				logrus.Errorf("failed to store idempotency key %v: %v", key, err)
+				handleError(w, http.StatusInternalServerError, err)
+				return
+			}
+
+			if !created {
+				switch {
+				case saved.RequestHash != requestHash:
+					writeErrorResponse(w, http.StatusConflict, "Idempotency-Key has already been used for a different request", nil)
+				case saved.Status == 0:
+					writeErrorResponse(w, http.StatusConflict, "A request with this Idempotency-Key is still being handled", nil)
+				case tokenBearing && saved.Status < http.StatusMultipleChoices:
+					writeCreatedDomainConflict(w, saved.Body)
+				default:
+					w.Header().Set("Content-Type", "application/json")
+					w.Header().Set("Idempotent-Replayed", "true")
+					w.WriteHeader(saved.Status)
+					_, _ = w.Write(saved.Body)
+				}
+				return
+			}
+
+			wrapped := wrapResponseWriter(w)
+			completed := false
+			defer func() {
+				// Release the key if the handler didn't finish, such as when it panicked
+				if !completed {
+					if err := b.AbandonIdempotentRequest(saved); err != nil {
+						logrus.Errorf("failed to release idempotency key %v: %v", key, err)
+					}
+				}
+			}()
+
+			next.ServeHTTP(wrapped, r)
+
+			status := wrapped.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status >= http.StatusInternalServerError {
+				return
+			}
+
+			saved.Status = status
+			saved.Body = wrapped.body
+			if tokenBearing && status < http.StatusMultipleChoices {
+				if saved.Body, err = withoutToken(saved.Body); err != nil {
+					logrus.Errorf("failed to remove token from response for idempotency key %v: %v", key, err)
+					return
+				}
+			}
+			if err := b.CompleteIdempotentRequest(saved); err != nil {
+				logrus.Errorf("failed to store response for idempotency key %v: %v", key, err)
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// withoutToken removes the token from a stored domain response
+func withoutToken(body []byte) ([]byte, error) {
+	var resp model.DomainResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	resp.Token = ""
+	return json.Marshal(resp)
+}
+
+// writeCreatedDomainConflict tells the client that retried creating a domain that the domain was created, but that its
+// token can't be returned again. The domain is purged once it expires, since it can't be renewed without its token.
+func writeCreatedDomainConflict(w http.ResponseWriter, body []byte) {
+	var resp model.DomainResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		handleError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeErrorResponse(w, http.StatusConflict,
+		"A domain was already created by a request with this Idempotency-Key and its token can't be returned again. "+
+			"Create another domain, this one expires unless it's renewed.",
+		map[string]string{"domain": resp.Name})
+}
@@ -0,0 +1,120 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/acorn-io/acorn-dns/pkg/backend"
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+)
+
+// idempotencyTestBackend keeps idempotency keys in a sqlite database and counts the domains it creates and the requests
+// it rate limits. Calling anything else panics.
+type idempotencyTestBackend struct {
+	backend.Backend
+	db            db.Database
+	domains       int
+	rateLimitHits int
+}
+
+func (b *idempotencyTestBackend) BeginIdempotentRequest(scope, key, requestHash string) (db.IdempotencyKey, bool, error) {
+	return b.db.CreateIdempotencyKey(db.IdempotencyKey{Scope: scope, Key: key, RequestHash: requestHash}, 3600)
+}
+
+func (b *idempotencyTestBackend) CompleteIdempotentRequest(key db.IdempotencyKey) error {
+	return b.db.SaveIdempotencyKey(key)
+}
+
+func (b *idempotencyTestBackend) AbandonIdempotentRequest(key db.IdempotencyKey) error {
+	return b.db.DeleteIdempotencyKey(key)
+}
+
+func (b *idempotencyTestBackend) AllowDomainCreation(string) (bool, time.Duration, error) {
+	b.rateLimitHits++
+	return true, 0, nil
+}
+
+func (b *idempotencyTestBackend) CreateDomain(zone, slug, _ string, _ bool, _ model.Actor) (model.DomainResponse, error) {
+	b.domains++
+	return model.DomainResponse{
+		Name:  fmt.Sprintf(".%v%v.example.com", slug, b.domains),
+		Zone:  "example.com",
+		Token: fmt.Sprintf("token%v", b.domains),
+	}, nil
+}
+
+func TestDomainCreationReplay(t *testing.T) {
+	database, err := db.New(context.Background(), "sqlite", "file:"+filepath.Join(t.TempDir(), "test.sqlite"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &idempotencyTestBackend{db: database}
+
+	// Wired like the route in server.go
+	handler := clientIPMiddleware(nil)(registrationMiddleware("secret", 0)(idempotencyMiddleware(b, true)(
+		domainCreationRateLimitMiddleware(b)(http.HandlerFunc(newHandler(b).createDomain)))))
+
+	tests := []struct {
+		name        string
+		remoteAddr  string
+		secret      string
+		key         string
+		body        string
+		wantStatus  int
+		wantDomains int
+		wantDomain  string
+	}{
+		{name: "created", remoteAddr: "192.0.2.1:1234", secret: "secret", key: "k1", body: `{"slug":"abc"}`, wantStatus: http.StatusCreated, wantDomains: 1},
+		{name: "retry without the registration secret", remoteAddr: "192.0.2.1:1234", key: "k1", body: `{"slug":"abc"}`, wantStatus: http.StatusUnauthorized, wantDomains: 1},
+		{name: "retry", remoteAddr: "192.0.2.1:4321", secret: "secret", key: "k1", body: `{"slug":"abc"}`, wantStatus: http.StatusConflict, wantDomains: 1, wantDomain: ".abc1.example.com"},
+		{name: "key reused for another request", remoteAddr: "192.0.2.1:1234", secret: "secret", key: "k1", body: `{"slug":"def"}`, wantStatus: http.StatusConflict, wantDomains: 1},
+		{name: "same key from another client", remoteAddr: "192.0.2.2:1234", secret: "secret", key: "k1", body: `{"slug":"abc"}`, wantStatus: http.StatusCreated, wantDomains: 2},
+		{name: "another key", remoteAddr: "192.0.2.1:1234", secret: "secret", key: "k2", body: `{"slug":"abc"}`, wantStatus: http.StatusCreated, wantDomains: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rateLimitHits := b.rateLimitHits
+			r := httptest.NewRequest(http.MethodPost, "/v1/domains", strings.NewReader(tt.body))
+			r.RemoteAddr = tt.remoteAddr
+			r.Header.Set("Idempotency-Key", tt.key)
+			if tt.secret != "" {
+				r.Header.Set("X-Registration-Secret", tt.secret)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if b.domains != tt.wantDomains {
+				t.Errorf("domains created = %v, want %v", b.domains, tt.wantDomains)
+			}
+			// Only requests that are handled again count against the rate limits
+			if handled := b.rateLimitHits > rateLimitHits; handled != (w.Code == http.StatusCreated) {
+				t.Errorf("rate limited = %v for status %v", handled, w.Code)
+			}
+			if strings.Contains(w.Body.String(), `"token":`) && w.Code != http.StatusCreated {
+				t.Errorf("response holds a token: %s", w.Body)
+			}
+			if tt.wantDomain != "" {
+				var resp struct {
+					Data map[string]string `json:"data"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				if resp.Data["domain"] != tt.wantDomain {
+					t.Errorf("conflict names domain %q, want %q", resp.Data["domain"], tt.wantDomain)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package apiserver
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/acorn-io/acorn-dns/pkg/backend"
+	"github.com/sirupsen/logrus"
+)
+
+// proofOfWorkMaxAge bounds how far a proof of work's timestamp can be from the server's clock
+const proofOfWorkMaxAge = 5 * time.Minute
+
+// domainCreationMiddleware protects the unauthenticated creation of domains. Requests must pass registrationMiddleware's
+// checks and are then subject to the backend's global and per-IP rate limits.
+func domainCreationMiddleware(b backend.Backend, registrationSecret string, proofOfWorkBits int) func(http.Handler) http.Handler {
+	registration := registrationMiddleware(registrationSecret, proofOfWorkBits)
+	return func(next http.Handler) http.Handler {
+		return registration(domainCreationRateLimitMiddleware(b)(next))
+	}
+}
+
+// registrationMiddleware checks what a client has to present to create a domain. If a registration secret is configured,
+// requests must carry it. If a proof of work difficulty is configured, requests must carry a proof of work.
+func registrationMiddleware(registrationSecret string, proofOfWorkBits int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if registrationSecret != "" {
+				secret := r.Header.Get("X-Registration-Secret")
+				if subtle.ConstantTimeCompare([]byte(secret), []byte(registrationSecret)) != 1 {
+					writeErrorResponse(w, http.StatusUnauthorized, "A valid registration secret is required", nil)
+					return
+				}
+			}
+
+			if proofOfWorkBits > 0 {
+				if err := verifyProofOfWork(r.Header.Get("X-Proof-Of-Work"), proofOfWorkBits, time.Now()); err != nil {
+					writeErrorResponse(w, http.StatusForbidden, "Proof of work failed: "+err.Error(), map[string]int{
+						"proofOfWorkBits": proofOfWorkBits,
+					})
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// domainCreationRateLimitMiddleware applies the backend's global and per-IP domain creation rate limits
+func domainCreationRateLimitMiddleware(b backend.Backend) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, retryAfter, err := b.AllowDomainCreation(clientIP(r))
+			if err != nil {
+				logrus.Errorf("failed to apply domain creation rate limits: %v", err)
+				handleError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if !allowed {
+				w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+				writeErrorResponse(w, http.StatusTooManyRequests, "Too many domains created, try again later", nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// verifyProofOfWork checks a proof of work of the form "<unix timestamp>:<nonce>", whose SHA-256 hash must start with
+// at least difficulty zero bits. The timestamp keeps a proof from being reused indefinitely, though it can be reused
+// until it's too old, which the rate limits account for.
+func verifyProofOfWork(proof string, difficulty int, now time.Time) error {
+	timestamp, _, ok := strings.Cut(proof, ":")
+	if !ok {
+		return errors.New("a proof of work is required in the X-Proof-Of-Work header")
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("the timestamp is invalid")
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > proofOfWorkMaxAge || age < -proofOfWorkMaxAge {
+		return errors.New("the timestamp is too far from the current time")
+	}
+
+	sum := sha256.Sum256([]byte(proof))
+	var zeros int
+	for _, b := range sum {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	if zeros < difficulty {
+		return errors.New("the hash doesn't have enough leading zero bits")
+	}
+	return nil
+}
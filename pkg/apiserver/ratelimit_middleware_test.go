@@ -0,0 +1,61 @@
+package apiserver
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/bits"
+	"testing"
+	"time"
+)
+
+// proofWithZeros finds a proof of work with the timestamp whose hash starts with exactly zeros zero bits
+func proofWithZeros(t *testing.T, timestamp int64, zeros int) string {
+	t.Helper()
+	for nonce := 0; nonce < 1<<24; nonce++ {
+		proof := fmt.Sprintf("%d:%d", timestamp, nonce)
+		sum := sha256.Sum256([]byte(proof))
+		var got int
+		for _, b := range sum {
+			got += bits.LeadingZeros8(b)
+			if b != 0 {
+				break
+			}
+		}
+		if got == zeros {
+			return proof
+		}
+	}
+	t.Fatalf("no proof of work with %v zero bits found", zeros)
+	return ""
+}
+
+func TestVerifyProofOfWork(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	proof := proofWithZeros(t, now.Unix(), 10)
+
+	tests := []struct {
+		name       string
+		proof      string
+		difficulty int
+		wantErr    bool
+	}{
+		{name: "exactly enough zero bits", proof: proof, difficulty: 10},
+		{name: "more than enough zero bits", proof: proof, difficulty: 4},
+		{name: "no difficulty", proof: proofWithZeros(t, now.Unix(), 0), difficulty: 0},
+		{name: "not enough zero bits", proof: proof, difficulty: 11, wantErr: true},
+		{name: "missing", proof: "", difficulty: 10, wantErr: true},
+		{name: "no nonce", proof: fmt.Sprint(now.Unix()), difficulty: 0, wantErr: true},
+		{name: "invalid timestamp", proof: "yesterday:1", difficulty: 0, wantErr: true},
+		{name: "slightly old", proof: proofWithZeros(t, now.Add(-4*time.Minute).Unix(), 10), difficulty: 10},
+		{name: "too old", proof: proofWithZeros(t, now.Add(-6*time.Minute).Unix(), 10), difficulty: 10, wantErr: true},
+		{name: "too far in the future", proof: proofWithZeros(t, now.Add(6*time.Minute).Unix(), 10), difficulty: 10, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyProofOfWork(tt.proof, tt.difficulty, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyProofOfWork(%q, %v) error = %v, wantErr %v", tt.proof, tt.difficulty, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,8 +2,13 @@ package apiserver
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/acorn-io/acorn-dns/pkg/backend"
 	"github.com/acorn-io/acorn-dns/pkg/model"
 )
 
@@ -24,6 +29,41 @@ func handleError(w http.ResponseWriter, httpStatus int, err error) {
 	writeErrorResponse(w, httpStatus, err.Error(), nil)
 }
 
+// handleBackendError writes err with a status matching the kind of backend error it is
+func handleBackendError(w http.ResponseWriter, err error) {
+	var rateLimitErr *backend.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		w.Header().Set("Retry-After", retryAfterSeconds(rateLimitErr.RetryAfter))
+	}
+	handleError(w, statusForBackendError(err), err)
+}
+
+func statusForBackendError(err error) int {
+	switch {
+	case errors.Is(err, backend.ErrInvalidRecord), errors.Is(err, backend.ErrInvalidSlug),
+		errors.Is(err, backend.ErrInvalidZone), errors.Is(err, backend.ErrVerificationFailed),
+		errors.Is(err, backend.ErrInvalidWebhook):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, backend.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, backend.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, backend.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, backend.ErrQuotaExceeded), errors.Is(err, backend.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, backend.ErrRateLimited):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// retryAfterSeconds formats d for a Retry-After header, which is in whole seconds
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
 func writeSuccess(w http.ResponseWriter, status int, data interface{}) {
 	res, err := json.Marshal(data)
 	if err != nil {
@@ -13,26 +13,64 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// Config holds the settings an API server is created with
+type Config struct {
+	Port int
+	// ACMEDNS enables the acme-dns compatible endpoints
+	ACMEDNS bool
+	// RegistrationSecret, if set, must be sent in the X-Registration-Secret header to create a domain
+	RegistrationSecret string
+	// ProofOfWorkBits, if set, is the difficulty of the proof of work required to create a domain
+	ProofOfWorkBits int
+	// AdminToken authenticates operators to the admin API, which is disabled if it isn't set
+	AdminToken string
+	// TrustedProxies are the addresses and CIDR ranges of the proxies whose X-Forwarded-For headers are believed
+	TrustedProxies []string
+}
+
 type apiServer struct {
-	ctx  context.Context
-	log  *logrus.Entry
-	port int
+	ctx                context.Context
+	log                *logrus.Entry
+	port               int
+	acmeDNS            bool
+	registrationSecret string
+	proofOfWorkBits    int
+	adminToken         string
+	trustedProxies     []string
 }
 
-func NewAPIServer(ctx context.Context, log *logrus.Entry, port int) *apiServer {
+func NewAPIServer(ctx context.Context, log *logrus.Entry, cfg Config) *apiServer {
 	return &apiServer{
-		ctx:  ctx,
-		log:  log,
-		port: port,
+		ctx:                ctx,
+		log:                log,
+		port:               cfg.Port,
+		acmeDNS:            cfg.ACMEDNS,
+		registrationSecret: cfg.RegistrationSecret,
+		proofOfWorkBits:    cfg.ProofOfWorkBits,
+		adminToken:         cfg.AdminToken,
+		trustedProxies:     cfg.TrustedProxies,
 	}
 }
 
 func (a *apiServer) Start(backend backend.Backend) error {
 	logrus.Infof("Version: %s", version.Get())
 
+	trustedProxies, err := parseTrustedProxies(a.trustedProxies)
+	if err != nil {
+		return err
+	}
+
 	router := mux.NewRouter().StrictSlash(true)
-	router.Use(loggingMiddleware(a.log))
+	router.Use(clientIPMiddleware(trustedProxies), loggingMiddleware(a.log))
 	h := newHandler(backend)
+	// Requests to the routes wrapped with idempotent can be retried safely with an Idempotency-Key header
+	idempotent := idempotencyMiddleware(backend, false)
+	// The responses to creating a domain hold its token, which isn't stored, so a created domain can't be replayed
+	idempotentDomainCreation := idempotencyMiddleware(backend, true)
+	// Creating a domain is unauthenticated, so it's protected against abuse instead
+	protected := domainCreationMiddleware(backend, a.registrationSecret, a.proofOfWorkBits)
+	registration := registrationMiddleware(a.registrationSecret, a.proofOfWorkBits)
+	rateLimited := domainCreationRateLimitMiddleware(backend)
 
 	// When functioning properly, these routes will return the version of tha app that is running
 	router.Path("/").HandlerFunc(h.root)
@@ -42,22 +80,89 @@ func (a *apiServer) Start(backend backend.Backend) error {
 
 	// POSTing to a domain creates a new domain and token. Further requests (below) against the created domain resource
 	// require authentication using the token
-	api.Path("/domains").Methods("POST").HandlerFunc(h.createDomain)
+	// Retries must pass the same checks as the original request, but are replayed before the rate limits apply, so that
+	// they don't use up the client's allowance
+	api.Path("/domains").Methods("POST").
+		Handler(registration(idempotentDomainCreation(rateLimited(http.HandlerFunc(h.createDomain)))))
+
+	// Custom domains are registered under a name the caller owns, and created once the name's ownership is verified.
+	// Verifying is unauthenticated too and costs a DNS lookup, so it's protected like registering is.
+	api.Path("/customdomains").Methods("POST").Handler(protected(http.HandlerFunc(h.registerCustomDomain)))
+	api.Path("/customdomains/{name}/verify").Methods("POST").Handler(protected(http.HandlerFunc(h.verifyCustomDomain)))
+
+	// Checks whether a slug can be requested when creating a domain. It's protected like creating a domain, and counts
+	// against the same rate limits, so that it can't be used to enumerate the slugs that are in use.
+	api.Path("/slugs/{slug}/availability").Methods("GET").Handler(protected(http.HandlerFunc(h.slugAvailability)))
+
+	// Lists the zones domains can be created in
+	api.Path("/zones").Methods("GET").HandlerFunc(h.getZones)
 
 	// All routes using this authedRoutes subrouter will require token based authentication
 	authedRoutes := api.PathPrefix("/domains/{domain}").Subrouter()
-	authedRoutes.Use(tokenAuthMiddleware(backend))
+	authedRoutes.Use(tokenAuthMiddleware(backend), gracePeriodMiddleware)
 
-	// Basic routes for the domain resource
-	authedRoutes.Methods("GET").HandlerFunc(h.getDomain)
+	// Basic routes for the domain resource. The empty path keeps this from matching GETs of sub-resources.
+	authedRoutes.Path("").Methods("GET").HandlerFunc(h.getDomain)
 
 	// These are for records sub-resource
-	authedRoutes.Path("/records").Methods("POST").HandlerFunc(h.createRecord)
+	authedRoutes.Path("/records").Methods("POST").Handler(idempotent(http.HandlerFunc(h.createRecord)))
+	authedRoutes.Path("/records").Methods("PUT").HandlerFunc(h.syncRecords)
+	authedRoutes.Path("/records:batch").Methods("POST").HandlerFunc(h.batchRecords)
+	authedRoutes.Path("/records/{record}").Methods("GET").HandlerFunc(h.getRecord)
 	authedRoutes.Path("/records/{record}").Methods("DELETE").HandlerFunc(h.deleteRecord)
+	authedRoutes.Path("/records/{record}/values").Methods("POST").HandlerFunc(h.updateRecordValues)
+
+	// These are for the health checks sub-resource
+	authedRoutes.Path("/healthchecks").Methods("POST").HandlerFunc(h.createHealthCheck)
+	authedRoutes.Path("/healthchecks").Methods("GET").HandlerFunc(h.getHealthChecks)
+	authedRoutes.Path("/healthchecks/{healthcheck}").Methods("GET").HandlerFunc(h.getHealthCheck)
+	authedRoutes.Path("/healthchecks/{healthcheck}").Methods("DELETE").HandlerFunc(h.deleteHealthCheck)
 
 	// These are "actions" that can be taken on a domain
-	authedRoutes.Path("/renew").Methods("POST").HandlerFunc(h.renew)
-	authedRoutes.Path("/purgerecords").Methods("POST").HandlerFunc(h.purgerecords)
+	authedRoutes.Path("/renew").Methods("POST").Handler(idempotent(http.HandlerFunc(h.renew)))
+	authedRoutes.Path("/purgerecords").Methods("POST").Handler(idempotent(http.HandlerFunc(h.purgerecords)))
+
+	// These add and remove individual ACME DNS-01 challenge values, leaving any others in place
+	authedRoutes.Path("/acme-challenge").Methods("POST").HandlerFunc(h.addACMEChallenge)
+	authedRoutes.Path("/acme-challenge").Methods("DELETE").HandlerFunc(h.removeACMEChallenge)
+
+	// Webhooks notify the domain's owner of its events
+	authedRoutes.Path("/webhooks").Methods("POST").HandlerFunc(h.createWebhook)
+	authedRoutes.Path("/webhooks").Methods("GET").HandlerFunc(h.getWebhooks)
+	authedRoutes.Path("/webhooks/{webhook}").Methods("DELETE").HandlerFunc(h.deleteWebhook)
+
+	// The audit log records every change made to the domain and its records
+	authedRoutes.Path("/audit").Methods("GET").HandlerFunc(h.getAuditLog)
+
+	// The admin API is for operators and requires the admin token
+	if a.adminToken != "" {
+		adminRoutes := api.PathPrefix("/admin").Subrouter()
+		adminRoutes.Use(adminAuthMiddleware(a.adminToken))
+		adminRoutes.Path("/domains/{domain}/quota").Methods("GET").HandlerFunc(h.getDomainQuota)
+		adminRoutes.Path("/domains/{domain}/quota").Methods("PUT").HandlerFunc(h.setDomainQuota)
+		adminRoutes.Path("/domains/{domain}/restore").Methods("POST").HandlerFunc(h.restoreDomain)
+		adminRoutes.Path("/namerules").Methods("GET").HandlerFunc(h.getNameRules)
+		adminRoutes.Path("/namerules").Methods("POST").HandlerFunc(h.createNameRule)
+		adminRoutes.Path("/namerules/{rule}").Methods("DELETE").HandlerFunc(h.deleteNameRule)
+		adminRoutes.Path("/invitations").Methods("GET").HandlerFunc(h.getInvitations)
+		adminRoutes.Path("/invitations").Methods("POST").HandlerFunc(h.createInvitation)
+		adminRoutes.Path("/invitations/{invitation}").Methods("DELETE").HandlerFunc(h.deleteInvitation)
+		adminRoutes.Path("/webhooks").Methods("POST").HandlerFunc(h.createWebhook)
+		adminRoutes.Path("/webhooks").Methods("GET").HandlerFunc(h.getWebhooks)
+		adminRoutes.Path("/webhooks/{webhook}").Methods("DELETE").HandlerFunc(h.deleteWebhook)
+		adminRoutes.Path("/audit").Methods("GET").HandlerFunc(h.getAuditLog)
+		adminRoutes.Path("/zones/{zone}/dnssec").Methods("GET").HandlerFunc(h.getZoneDNSSEC)
+		adminRoutes.Path("/zones/{zone}/dnssec").Methods("PUT").HandlerFunc(h.enableZoneDNSSEC)
+		adminRoutes.Path("/zones/{zone}/dnssec").Methods("DELETE").HandlerFunc(h.disableZoneDNSSEC)
+		adminRoutes.Path("/zones/{zone}/dnssec/keys").Methods("POST").HandlerFunc(h.rotateZoneKeySigningKey)
+		adminRoutes.Path("/zones/{zone}/dnssec/keys/{key}").Methods("DELETE").HandlerFunc(h.deleteZoneKeySigningKey)
+	}
+
+	// These implement the acme-dns API, which authenticates with its own headers instead of a bearer token
+	if a.acmeDNS {
+		router.Path("/register").Methods("POST").Handler(protected(http.HandlerFunc(h.acmeDNSRegister)))
+		router.Path("/update").Methods("POST").HandlerFunc(h.acmeDNSUpdate)
+	}
 
 	// Note: this allows not found urls to be logged via the middleware
 	// It **HAS** to be defined after all other paths are defined.
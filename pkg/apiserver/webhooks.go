@@ -0,0 +1,52 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/gorilla/mux"
+)
+
+// The webhook handlers serve both a domain's own subscriptions and, in the admin API, the global ones. Admin requests
+// aren't authenticated as a domain, so there's no domain ID in their context and they get the global subscriptions.
+
+func (h *handler) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var input model.WebhookRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&input); err != nil {
+		handleError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp, err := h.backend.CreateWebhookSubscription(domainIDFromContext(r.Context()), input)
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+	writeSuccess(w, http.StatusCreated, resp)
+}
+
+func (h *handler) getWebhooks(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.backend.GetWebhookSubscriptions(domainIDFromContext(r.Context()))
+	if err != nil {
+		handleBackendError(w, err)
+		return
+	}
+	writeSuccess(w, http.StatusOK, resp)
+}
+
+func (h *handler) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["webhook"], 10, 64)
+	if err != nil {
+		handleError(w, http.StatusNotFound, fmt.Errorf("webhook %v doesn't exist", mux.Vars(r)["webhook"]))
+		return
+	}
+
+	if err := h.backend.DeleteWebhookSubscription(domainIDFromContext(r.Context()), uint(id)); err != nil {
+		handleBackendError(w, err)
+		return
+	}
+}
@@ -0,0 +1,263 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	acmeChallengeLabel = "_acme-challenge"
+
+	// propagationTimeout bounds how long adding a challenge waits for Route53 to report the change as in sync
+	propagationTimeout      = 2 * time.Minute
+	propagationPollInterval = 2 * time.Second
+)
+
+// AddACMEChallenge adds a value to the ACME DNS-01 challenge TXT record for the given name, keeping any values already
+// there so that several challenges (such as for a name and its wildcard) can be solved at once. If wait is true, it
+// returns once the change has propagated to Route53's name servers. The value expires after the configured max age.
+func (b *backend) AddACMEChallenge(domain string, domainID uint, input model.ACMEChallengeRequest, wait bool, actor model.Actor) (model.RecordResponse, error) {
+	fqdn := acmeChallengeFQDN(input.Name, domain)
+
+	existing, record, changeID, err := b.setChallengeValues(fqdn, domainID, func(existing db.Record) []db.RecordValue {
+		expiresAt := time.Now().Add(time.Duration(b.acmeChallengeMaxAgeSeconds) * time.Second)
+		values := make([]db.RecordValue, 0, len(existing.Values)+1)
+		for _, v := range existing.Values {
+			if v.Value != input.Value {
+				values = append(values, v)
+			}
+		}
+		// A repeated value is re-added so that its expiry is extended
+		return append(values, db.RecordValue{Value: input.Value, ExpiresAt: &expiresAt})
+	})
+	if err != nil {
+		return model.RecordResponse{}, err
+	}
+	b.reportChallengeChange(actor, domainID, domain, existing, record, changeID)
+
+	if wait {
+		if err := b.waitForChange(changeID); err != nil {
+			return model.RecordResponse{}, fmt.Errorf("route53 change for %v did not propagate: %v", fqdn, err)
+		}
+	}
+
+	return model.RecordResponse{
+		RecordRequest: model.RecordRequest{
+			Name:   strings.TrimSuffix(fqdn, domain),
+			Type:   model.RecordTypeTxt,
+			Values: record.ValueStrings(),
+			TTL:    record.TTL,
+		},
+		FQDN: fqdn,
+	}, nil
+}
+
+// RemoveACMEChallenge removes a single value from the ACME DNS-01 challenge TXT record for the given name. The record
+// is deleted when no values are left.
+func (b *backend) RemoveACMEChallenge(domain string, domainID uint, input model.ACMEChallengeRequest, actor model.Actor) error {
+	fqdn := acmeChallengeFQDN(input.Name, domain)
+
+	var found bool
+	existing, record, changeID, err := b.setChallengeValues(fqdn, domainID, func(existing db.Record) []db.RecordValue {
+		values := make([]db.RecordValue, 0, len(existing.Values))
+		for _, v := range existing.Values {
+			if v.Value != input.Value {
+				values = append(values, v)
+			}
+		}
+		found = len(values) < len(existing.Values)
+		return values
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %v has no challenge value %v", ErrNotFound, fqdn, input.Value)
+	}
+	b.reportChallengeChange(actor, domainID, domain, existing, record, changeID)
+	return nil
+}
+
+// expireACMEChallenges removes challenge values whose max age has passed. Clients are expected to remove their values
+// once the challenge is done, so this only cleans up after ones that didn't.
+func (b *backend) expireACMEChallenges() {
+	records, err := b.db.GetRecordsWithExpiredValues()
+	if err != nil {
+		logrus.Errorf("Could not load records with expired values from database. Error: %v", err)
+		return
+	}
+
+	for _, record := range records {
+		var expired int
+		existing, updated, changeID, err := b.setChallengeValues(record.FQDN, record.DomainID, func(existing db.Record) []db.RecordValue {
+			now := time.Now()
+			values := make([]db.RecordValue, 0, len(existing.Values))
+			for _, v := range existing.Values {
+				if v.ExpiresAt == nil || v.ExpiresAt.After(now) {
+					values = append(values, v)
+				}
+			}
+			expired = len(existing.Values) - len(values)
+			return values
+		})
+		if err != nil {
+			logrus.Errorf("Unable to remove expired values of %v. Error: %v", record.FQDN, err)
+			continue
+		}
+		if expired == 0 {
+			continue
+		}
+		if domain, err := b.db.GetDomainByID(record.DomainID); err != nil {
+			logrus.Errorf("Could not load domain %v from database. Error: %v", record.DomainID, err)
+		} else {
+			b.reportChallengeChange(model.Actor{}, record.DomainID, domain.Domain, existing, updated, changeID)
+		}
+		logrus.Infof("Expired values removed from %v: %v", record.FQDN, expired)
+	}
+}
+
+func (b *backend) getChallengeRecord(fqdn string, domainID uint) (db.Record, error) {
+	records, err := b.db.GetDomainRecordsByFQDN(fqdn, domainID)
+	if err != nil {
+		return db.Record{}, err
+	}
+	for _, r := range records {
+		if r.Type == model.RecordTypeTxt && r.SetIdentifier == "" {
+			return r, nil
+		}
+	}
+	return db.Record{}, nil
+}
+
+// setChallengeValues makes the TXT record at fqdn hold the values that update returns for it, in both Route53 and the
+// database, deleting the record when there are none. The record is returned as it was before and after the change,
+// along with the ID of the Route53 change, which is empty if nothing changed.
+//
+// Like UpdateRecordValues, the change is made by deleting the exact record set that was read and creating the new one
+// in the same change batch, so that Route53 rejects it if another request, possibly on another replica, changed the
+// record in the meantime. update is then called again with the record as it is now.
+func (b *backend) setChallengeValues(fqdn string, domainID uint, update func(existing db.Record) []db.RecordValue) (db.Record, db.Record, string, error) {
+	z, err := b.domainZone(domainID)
+	if err != nil {
+		return db.Record{}, db.Record{}, "", err
+	}
+
+	var (
+		existing, result db.Record
+		changeID         string
+	)
+	err = wait.ExponentialBackoff(valuesUpdateBackoff, func() (bool, error) {
+		var err error
+		existing, err = b.getChallengeRecord(fqdn, domainID)
+		if err != nil {
+			return false, err
+		}
+
+		values := update(existing)
+		if len(values) == 0 && existing.ID == 0 {
+			result, changeID = db.Record{}, ""
+			return true, nil
+		}
+
+		record := db.Record{
+			FQDN:     fqdn,
+			Type:     model.RecordTypeTxt,
+			DomainID: domainID,
+			Values:   values,
+			// Challenge values are short-lived, so keep resolvers from caching them any longer than allowed
+			TTL: b.recordMinTTLSeconds,
+		}
+
+		var changes []*route53.Change
+		if existing.ID != 0 {
+			changes = append(changes, &route53.Change{
+				Action:            aws.String("DELETE"),
+				ResourceRecordSet: b.resourceRecordSet(existing),
+			})
+		}
+		if len(values) > 0 {
+			changes = append(changes, &route53.Change{
+				Action:            aws.String("CREATE"),
+				ResourceRecordSet: b.resourceRecordSet(record),
+			})
+		}
+
+		out, err := b.Svc.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(z.id),
+			ChangeBatch: &route53.ChangeBatch{
+				Changes: changes,
+			},
+		})
+		if isRecordSetMismatch(err) {
+			// The record set no longer matches what was read. Try again with a fresh read.
+			return false, nil
+		} else if isInvalidChangeBatch(err) {
+			return false, invalidChangeBatchError(err)
+		} else if err != nil {
+			return false, fmt.Errorf("failed to update route53 record %v with error %v", fqdn, err)
+		}
+		changeID = aws.StringValue(out.ChangeInfo.Id)
+
+		if len(values) == 0 {
+			result = db.Record{}
+			return true, b.db.DeleteRecords([]db.Record{existing})
+		}
+		result, err = b.db.PersistRecord(record, 0)
+		return err == nil, err
+	})
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		return db.Record{}, db.Record{}, "", fmt.Errorf("%w: %v is being changed concurrently, try again", ErrConflict, fqdn)
+	} else if err != nil {
+		return db.Record{}, db.Record{}, "", err
+	}
+	return existing, result, changeID, nil
+}
+
+// reportChallengeChange records the change setChallengeValues made to a challenge record, which is deleted if the
+// record it returned has no ID, in the audit log and emits its event
+func (b *backend) reportChallengeChange(actor model.Actor, domainID uint, domain string, existing, record db.Record, changeID string) {
+	switch {
+	case existing.ID == 0:
+		b.audit(actor, domainID, domain, model.AuditRecordCreate, nil, []db.Record{record}, changeID)
+		b.emitRecordChanges(domainID, domain, nil, []db.Record{record})
+	case record.ID == 0:
+		b.audit(actor, domainID, domain, model.AuditRecordDelete, []db.Record{existing}, nil, changeID)
+		b.emitRecordChanges(domainID, domain, []db.Record{existing}, nil)
+	default:
+		b.audit(actor, domainID, domain, model.AuditRecordUpdate, []db.Record{existing}, []db.Record{record}, changeID)
+		b.emitRecordChanges(domainID, domain, nil, []db.Record{record})
+	}
+}
+
+// waitForChange blocks until Route53 reports that a change has propagated to all of its name servers
+func (b *backend) waitForChange(changeID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), propagationTimeout)
+	defer cancel()
+
+	return b.Svc.WaitUntilResourceRecordSetsChangedWithContext(ctx,
+		&route53.GetChangeInput{Id: aws.String(changeID)},
+		request.WithWaiterDelay(request.ConstantWaiterDelay(propagationPollInterval)),
+		request.WithWaiterMaxAttempts(int(propagationTimeout/propagationPollInterval)))
+}
+
+// acmeChallengeFQDN returns the FQDN of the challenge record for name, which is relative to domain. A wildcard name
+// shares the challenge record of the name it's a wildcard for.
+func acmeChallengeFQDN(name, domain string) string {
+	name = strings.TrimPrefix(name, "*")
+	name = strings.TrimPrefix(name, ".")
+	if name == "" {
+		return acmeChallengeLabel + domain
+	}
+	return acmeChallengeLabel + "." + name + domain
+}
@@ -0,0 +1,129 @@
+package backend
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+)
+
+// audit records an operation in the audit log. Like webhook events, entries are recorded once the change has been made,
+// so failing to record one is only logged.
+func (b *backend) audit(actor model.Actor, domainID uint, domainName, operation string, before, after []db.Record, changeID string) {
+	entry := db.AuditEntry{
+		DomainID:   domainID,
+		Domain:     domainName,
+		Operation:  operation,
+		TokenID:    actor.TokenID,
+		RemoteIP:   actor.RemoteIP,
+		RemoteAddr: actor.RemoteAddr,
+		UserAgent:  actor.UserAgent,
+		ChangeID:   changeID,
+	}
+
+	var err error
+	if len(before) > 0 {
+		if entry.Before, err = json.Marshal(auditRecords(before)); err != nil {
+			logrus.Errorf("Unable to marshal records of %v audit entry. Error: %v", operation, err)
+		}
+	}
+	if len(after) > 0 {
+		if entry.After, err = json.Marshal(auditRecords(after)); err != nil {
+			logrus.Errorf("Unable to marshal records of %v audit entry. Error: %v", operation, err)
+		}
+	}
+
+	if err := b.db.CreateAuditEntry(entry); err != nil {
+		logrus.Errorf("Unable to record %v of %v in audit log. Error: %v", operation, domainName, err)
+	}
+}
+
+// GetAuditLog returns a page of the audit log, newest entry first. The log is limited to the domain with the given ID,
+// or, if domainID is 0, to the domain with the given name if one is given. beforeID is the cursor of the page.
+func (b *backend) GetAuditLog(domainID uint, domainName string, beforeID uint, limit int) (model.AuditLogResponse, error) {
+	if limit <= 0 {
+		limit = defaultAuditPageSize
+	} else if limit > maxAuditPageSize {
+		limit = maxAuditPageSize
+	}
+
+	entries, err := b.db.GetAuditEntries(domainID, domainName, beforeID, limit)
+	if err != nil {
+		return model.AuditLogResponse{}, err
+	}
+
+	resp := model.AuditLogResponse{Entries: make([]model.AuditEntryResponse, 0, len(entries))}
+	for _, e := range entries {
+		entry := model.AuditEntryResponse{
+			ID:         e.ID,
+			Time:       e.CreatedAt.UTC().Format(time.RFC3339),
+			Domain:     e.Domain,
+			Operation:  e.Operation,
+			TokenID:    e.TokenID,
+			RemoteIP:   e.RemoteIP,
+			RemoteAddr: e.RemoteAddr,
+			UserAgent:  e.UserAgent,
+			ChangeID:   e.ChangeID,
+		}
+		if len(e.Before) > 0 {
+			if err := json.Unmarshal(e.Before, &entry.Before); err != nil {
+				return model.AuditLogResponse{}, err
+			}
+		}
+		if len(e.After) > 0 {
+			if err := json.Unmarshal(e.After, &entry.After); err != nil {
+				return model.AuditLogResponse{}, err
+			}
+		}
+		resp.Entries = append(resp.Entries, entry)
+	}
+	if len(entries) == limit {
+		resp.Next = strconv.FormatUint(uint64(entries[len(entries)-1].ID), 10)
+	}
+	return resp, nil
+}
+
+// purgeAuditLog deletes the audit entries that are older than the audit log's max age
+func (b *backend) purgeAuditLog() {
+	deleted, err := b.db.PurgeOldAuditEntries(b.auditLogMaxAgeSeconds)
+	if err != nil {
+		logrus.Errorf("problem purging old audit entries: %v", err)
+		return
+	}
+	logrus.Infof("Audit entries purged from DB: %v", deleted)
+}
+
+func auditRecords(records []db.Record) []model.RecordResponse {
+	resp := make([]model.RecordResponse, 0, len(records))
+	for _, r := range records {
+		resp = append(resp, recordResponse(r))
+	}
+	return resp
+}
+
+// recordResponse describes the record by its FQDN. The name relative to its domain and its ETag are left to the
+// caller.
+func recordResponse(r db.Record) model.RecordResponse {
+	record := model.RecordResponse{
+		RecordRequest: model.RecordRequest{
+			Type:          r.Type,
+			Values:        r.ValueStrings(),
+			TTL:           r.TTL,
+			RoutingPolicy: r.Routing(),
+		},
+		FQDN: r.FQDN,
+	}
+	if r.Type == model.RecordTypeAlias {
+		alias := r.Alias
+		record.AliasTarget = &alias
+	}
+	return record
+}
@@ -1,16 +1,55 @@
 package backend
 
 import (
+	"time"
+
 	"github.com/acorn-io/acorn-dns/pkg/db"
 	"github.com/acorn-io/acorn-dns/pkg/model"
 )
 
 type Backend interface {
 	GetDomain(domainName string) (db.Domain, error)
-	CreateDomain() (model.DomainResponse, error)
-	Renew(domain string, domainID uint, records []model.RecordRequest, version string) ([]model.FQDNTypePair, error)
-	PurgeRecords(domain string, domainID uint) error
-	CreateRecord(domain string, domainID uint, input model.RecordRequest) (model.RecordResponse, error)
-	DeleteRecord(recordPrefix string, domain string, domainID uint) error
+	CreateDomain(zone, slug, invitationCode string, neverExpires bool, actor model.Actor) (model.DomainResponse, error)
+	GetZones() []model.ZoneResponse
+	RegisterCustomDomain(name string) (model.CustomDomainResponse, error)
+	VerifyCustomDomain(name, token string, actor model.Actor) (model.DomainResponse, error)
+	SlugAvailability(slug, invitationCode string) (model.SlugAvailabilityResponse, error)
+	AllowDomainCreation(ip string) (bool, time.Duration, error)
+	DomainExpiry(domain db.Domain) *model.DomainExpiry
+	GetDomainQuota(domain db.Domain, withOverride bool) (model.QuotaResponse, error)
+	SetDomainQuotaOverride(domainName string, override model.DomainQuotaOverride) (model.QuotaResponse, error)
+	RestoreDomain(domainName string, actor model.Actor) (model.DomainResponse, error)
+	Renew(domain string, domainID uint, records []model.RecordRequest, version string, actor model.Actor) ([]model.FQDNTypePair, error)
+	PurgeRecords(domain string, domainID uint, actor model.Actor) error
+	SyncRecords(domain string, domainID uint, records []model.RecordRequest, version string, actor model.Actor) (model.RecordSyncResponse, error)
+	GetRecord(recordPrefix string, domain string, domainID uint, rType string, setIdentifier string) (model.RecordResponse, error)
+	CreateRecord(domain string, domainID uint, input model.RecordRequest, precondition model.Precondition, actor model.Actor) (model.RecordResponse, error)
+	UpdateRecordValues(domain string, domainID uint, recordPrefix string, input model.RecordValuesRequest, precondition model.Precondition, actor model.Actor) (model.RecordResponse, error)
+	ApplyRecordBatch(domain string, domainID uint, ops []model.RecordBatchOperation, actor model.Actor) ([]model.RecordBatchResult, error)
+	DeleteRecord(recordPrefix string, domain string, domainID uint, rType string, setIdentifier string, precondition model.Precondition, actor model.Actor) error
+	CreateHealthCheck(domain string, domainID uint, input model.HealthCheckRequest) (model.HealthCheckResponse, error)
+	GetHealthChecks(domainID uint) ([]model.HealthCheckResponse, error)
+	GetHealthCheck(domainID uint, id string) (model.HealthCheckResponse, error)
+	DeleteHealthCheck(domainID uint, id string) error
+	AddACMEChallenge(domain string, domainID uint, input model.ACMEChallengeRequest, wait bool, actor model.Actor) (model.RecordResponse, error)
+	RemoveACMEChallenge(domain string, domainID uint, input model.ACMEChallengeRequest, actor model.Actor) error
+	BeginIdempotentRequest(scope, key, requestHash string) (db.IdempotencyKey, bool, error)
+	CompleteIdempotentRequest(key db.IdempotencyKey) error
+	AbandonIdempotentRequest(key db.IdempotencyKey) error
+	GetZoneDNSSEC(zoneName string) (model.DNSSECResponse, error)
+	EnableZoneDNSSEC(zoneName string) (model.DNSSECResponse, error)
+	DisableZoneDNSSEC(zoneName string) (model.DNSSECResponse, error)
+	RotateZoneKeySigningKey(zoneName string) (model.DNSSECResponse, error)
+	DeleteZoneKeySigningKey(zoneName, keyName string) (model.DNSSECResponse, error)
+	CreateWebhookSubscription(domainID uint, input model.WebhookRequest) (model.WebhookResponse, error)
+	GetWebhookSubscriptions(domainID uint) ([]model.WebhookResponse, error)
+	DeleteWebhookSubscription(domainID uint, id uint) error
+	GetAuditLog(domainID uint, domainName string, beforeID uint, limit int) (model.AuditLogResponse, error)
+	GetNameRules() ([]model.NameRule, error)
+	CreateNameRule(rule model.NameRule) (model.NameRule, error)
+	DeleteNameRule(id uint) error
+	GetInvitations() ([]model.InvitationResponse, error)
+	CreateInvitation(uses int64) (model.InvitationResponse, error)
+	DeleteInvitation(id uint) error
 	StartPurgerDaemon(done <-chan struct{})
 }
@@ -0,0 +1,254 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+)
+
+const (
+	// maxBatchOperations is the most operations a batch can have
+	maxBatchOperations = 500
+	// maxBatchChanges is Route53's limit of changes per change batch. A delete operation can change many record sets, so
+	// a batch's changes are counted as well as its operations.
+	maxBatchChanges = 1000
+)
+
+// ApplyRecordBatch applies many record operations at once. All operations are validated before anything is changed, and
+// the changes are then made in a single Route53 change batch and a single database transaction, so either all or none of
+// them are applied. If any operation is invalid, a *BatchError describing each operation is returned.
+func (b *backend) ApplyRecordBatch(domain string, domainID uint, ops []model.RecordBatchOperation, actor model.Actor) ([]model.RecordBatchResult, error) {
+	return b.applyRecordBatch(domain, domainID, ops, actor, model.AuditRecordsBatch)
+}
+
+// applyRecordBatch applies a batch of record operations and records it in the audit log as the given operation
+func (b *backend) applyRecordBatch(domain string, domainID uint, ops []model.RecordBatchOperation, actor model.Actor, operation string) ([]model.RecordBatchResult, error) {
+	if len(ops) == 0 || len(ops) > maxBatchOperations {
+		return nil, fmt.Errorf("%w: a batch must have between 1 and %v operations", ErrInvalidRecord, maxBatchOperations)
+	}
+
+	domainRecords, err := b.db.GetDomainRecords(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	quota, err := b.loadDomainQuota(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	checkName, err := b.recordNameChecker()
+	if err != nil {
+		return nil, err
+	}
+
+	// current is the state of the domain's records as it will be after the operations processed so far, so that every
+	// operation is validated against the ones before it
+	current := make(map[string]map[model.FQDNTypePair]db.Record)
+	for pair, r := range domainRecords {
+		if current[r.FQDN] == nil {
+			current[r.FQDN] = make(map[model.FQDNTypePair]db.Record)
+		}
+		current[r.FQDN][pair] = r
+	}
+
+	var (
+		changes []*route53.Change
+		// undo holds the changes that undo the batch's changes, in reverse order
+		undo    []*route53.Change
+		persist []db.Record
+		remove  []db.Record
+		invalid bool
+		// created counts the records that don't exist yet
+		created int
+	)
+	touched := make(map[model.FQDNTypePair]bool)
+	results := make([]model.RecordBatchResult, len(ops))
+	errs := make([]error, len(ops))
+
+	for i, op := range ops {
+		results[i].Action = op.Action
+		fqdn := op.Name + domain
+		if current[fqdn] == nil {
+			current[fqdn] = make(map[model.FQDNTypePair]db.Record)
+		}
+
+		switch op.Action {
+		case model.BatchActionCreate, model.BatchActionUpdate:
+			input := op.RecordRequest
+			pair := model.FQDNTypePair{FQDN: fqdn, Type: input.Type, SetIdentifier: input.SetIdentifier()}
+			_, exists := current[fqdn][pair]
+			if op.Action == model.BatchActionCreate && exists {
+				errs[i] = fmt.Errorf("%w: %v already has an %v record", ErrConflict, fqdn, input.Type)
+				break
+			} else if op.Action == model.BatchActionUpdate && !exists {
+				errs[i] = fmt.Errorf("%w: %v has no %v record", ErrNotFound, fqdn, input.Type)
+				break
+			}
+			if touched[pair] {
+				errs[i] = fmt.Errorf("%w: the batch has more than one operation on %v record %v", ErrInvalidRecord, input.Type, fqdn)
+				break
+			}
+			if err := checkName(input.Name); err != nil {
+				errs[i] = err
+				break
+			}
+
+			record, err := b.newRecord(fqdn, domainID, &input, maps.Values(current[fqdn]))
+			if err != nil {
+				errs[i] = err
+				break
+			}
+			if err := checkValuesQuota(quota, fqdn, len(record.Values)); err != nil {
+				errs[i] = err
+				break
+			}
+
+			change := &route53.Change{
+				Action:            aws.String("CREATE"),
+				ResourceRecordSet: b.resourceRecordSet(record),
+			}
+			undoChange := &route53.Change{
+				Action:            aws.String("DELETE"),
+				ResourceRecordSet: change.ResourceRecordSet,
+			}
+			if exists {
+				change.Action = aws.String("UPSERT")
+				undoChange = &route53.Change{
+					Action:            aws.String("UPSERT"),
+					ResourceRecordSet: b.resourceRecordSet(current[fqdn][pair]),
+				}
+			} else {
+				created++
+			}
+			changes = append(changes, change)
+			undo = append([]*route53.Change{undoChange}, undo...)
+			persist = append(persist, record)
+			touched[pair] = true
+			current[fqdn][pair] = record
+			results[i].Record = &model.RecordResponse{RecordRequest: input, FQDN: fqdn}
+		case model.BatchActionDelete:
+			var deleted []model.FQDNTypePair
+			for pair, r := range current[fqdn] {
+				if op.Type != "" && r.Type != op.Type || op.SetIdentifier() != "" && r.SetIdentifier != op.SetIdentifier() {
+					continue
+				}
+				if touched[pair] {
+					errs[i] = fmt.Errorf("%w: the batch has more than one operation on %v record %v", ErrInvalidRecord, r.Type, fqdn)
+					break
+				}
+				deleted = append(deleted, pair)
+			}
+			if errs[i] != nil {
+				break
+			}
+			if len(deleted) == 0 {
+				errs[i] = fmt.Errorf("%w: %v has no matching records", ErrNotFound, fqdn)
+				break
+			}
+
+			for _, pair := range deleted {
+				r := current[fqdn][pair]
+				recordSet := b.resourceRecordSet(r)
+				changes = append(changes, &route53.Change{
+					Action:            aws.String("DELETE"),
+					ResourceRecordSet: recordSet,
+				})
+				undo = append([]*route53.Change{{
+					Action:            aws.String("CREATE"),
+					ResourceRecordSet: recordSet,
+				}}, undo...)
+				remove = append(remove, r)
+				touched[pair] = true
+				delete(current[fqdn], pair)
+			}
+			results[i].Deleted = deleted
+		default:
+			errs[i] = fmt.Errorf("%w: action must be %v, %v or %v", ErrInvalidRecord,
+				model.BatchActionCreate, model.BatchActionUpdate, model.BatchActionDelete)
+		}
+
+		if errs[i] != nil {
+			invalid = true
+		}
+	}
+
+	if invalid {
+		return nil, &BatchError{Errors: errs}
+	}
+
+	if size := changeBatchSize(changes); size > maxBatchChanges {
+		return nil, fmt.Errorf("%w: the batch makes %v changes, which is more than the limit of %v, counting updates twice",
+			ErrInvalidRecord, size, maxBatchChanges)
+	}
+
+	if err := b.checkRecordsQuota(quota, domainID, created-len(remove)); err != nil {
+		return nil, err
+	}
+	if err := b.takeMutation(quota, domainID); err != nil {
+		return nil, err
+	}
+
+	z, err := b.domainZone(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	rrsInput := route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(z.id),
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: changes,
+		},
+	}
+	out, err := b.Svc.ChangeResourceRecordSets(&rrsInput)
+	if isInvalidChangeBatch(err) {
+		return nil, invalidChangeBatchError(err)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to apply route53 change batch with error %v", err)
+	}
+
+	if err := b.db.ApplyRecordBatch(persist, remove, recordsLimit(quota, created-len(remove))); errors.Is(err, db.ErrTooManyRecords) {
+		b.undoChanges(z, undo)
+		return nil, recordsQuotaError(quota)
+	} else if err != nil {
+		return nil, err
+	}
+	if err := b.deleteRecordsHealthChecks(remove); err != nil {
+		logrus.Errorf("Unable to delete health checks of records removed by batch for domain %v. Error: %v", domain, err)
+	}
+
+	// The records the batch replaced are as they were before it, along with the ones it removed
+	before := remove
+	for _, r := range persist {
+		if existing, ok := domainRecords[r.Pair()]; ok {
+			before = append(before, existing)
+		}
+	}
+	b.audit(actor, domainID, domain, operation, before, persist, aws.StringValue(out.ChangeInfo.Id))
+	b.emitRecordChanges(domainID, domain, remove, persist)
+
+	return results, nil
+}
+
+// changeBatchSize counts the changes the way Route53 does against its limit of changes per change batch, where an UPSERT
+// counts twice
+func changeBatchSize(changes []*route53.Change) int {
+	var size int
+	for _, change := range changes {
+		size += changeSize(aws.StringValue(change.Action))
+	}
+	return size
+}
+
+func changeSize(action string) int {
+	if action == "UPSERT" {
+		return 2
+	}
+	return 1
+}
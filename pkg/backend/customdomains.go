@@ -0,0 +1,156 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/acorn-io/acorn-dns/pkg/rand"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	customDomainChallengeLabel  = "_acorn-dns-challenge"
+	customDomainChallengeLength = 32
+
+	// verificationLookupTimeout bounds how long the lookup of a custom domain's challenge can take
+	verificationLookupTimeout = 10 * time.Second
+)
+
+// newResolver returns a resolver that sends its queries to the DNS server at addr, or the system's resolver if addr is
+// empty
+func newResolver(addr string) *net.Resolver {
+	if addr == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// RegisterCustomDomain starts the creation of a domain under a name the caller owns, rather than under one of the
+// served zones. The domain is only created once VerifyCustomDomain finds the returned challenge in a TXT record.
+func (b *backend) RegisterCustomDomain(name string) (model.CustomDomainResponse, error) {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return model.CustomDomainResponse{}, fmt.Errorf("%w: %v", ErrInvalidZone, strings.Join(errs, ", "))
+	}
+	if !strings.Contains(name, ".") {
+		return model.CustomDomainResponse{}, fmt.Errorf("%w: %v is a top level domain", ErrInvalidZone, name)
+	}
+
+	z, err := b.customDomainZone(name)
+	if err != nil {
+		return model.CustomDomainResponse{}, err
+	}
+
+	token, hash, err := b.createToken()
+	if err != nil {
+		return model.CustomDomainResponse{}, err
+	}
+
+	verification, err := b.db.CreateCustomDomainVerification(db.CustomDomainVerification{
+		Name:      name,
+		Zone:      z.name,
+		TokenHash: hash,
+		Challenge: rand.StringWithSmall(customDomainChallengeLength),
+	}, b.customDomainVerificationMaxAgeSeconds)
+	if errors.Is(err, db.ErrNameTaken) {
+		return model.CustomDomainResponse{}, fmt.Errorf("%w: %v is taken", ErrConflict, name)
+	} else if err != nil {
+		return model.CustomDomainResponse{}, err
+	}
+
+	return model.CustomDomainResponse{
+		Name:  verification.Name,
+		Zone:  verification.Zone,
+		Token: token,
+		Challenge: model.RecordRequest{
+			Name:   customDomainChallengeLabel + "." + verification.Name,
+			Type:   model.RecordTypeTxt,
+			Values: []string{verification.Challenge},
+		},
+	}, nil
+}
+
+// VerifyCustomDomain creates the custom domain registered with the given name and token if the TXT record holding its
+// challenge can be found
+func (b *backend) VerifyCustomDomain(name, token string, actor model.Actor) (model.DomainResponse, error) {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+
+	verification, err := b.db.GetCustomDomainVerification(name)
+	if err != nil {
+		return model.DomainResponse{}, err
+	}
+	expiry := time.Now().Add(-time.Second * time.Duration(b.customDomainVerificationMaxAgeSeconds))
+	if verification.ID == 0 || verification.CreatedAt.Before(expiry) {
+		return model.DomainResponse{}, fmt.Errorf("%w: %v has no pending verification", ErrNotFound, name)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(verification.TokenHash), []byte(token)); err != nil {
+		return model.DomainResponse{}, fmt.Errorf("%w: the token doesn't match the one %v was registered with", ErrForbidden, name)
+	}
+
+	if err := b.lookupCustomDomainChallenge(verification); err != nil {
+		return model.DomainResponse{}, err
+	}
+
+	domain, err := b.db.CompleteCustomDomainVerification(verification)
+	if errors.Is(err, db.ErrNameTaken) {
+		return model.DomainResponse{}, fmt.Errorf("%w: %v is taken", ErrConflict, name)
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.DomainResponse{}, fmt.Errorf("%w: %v has no pending verification", ErrNotFound, name)
+	} else if err != nil {
+		return model.DomainResponse{}, err
+	}
+
+	logrus.Infof("Custom domain %v verified", name)
+	b.audit(actor, domain.ID, domain.Domain, model.AuditDomainCreate, nil, nil, "")
+	return model.DomainResponse{
+		Name: domain.Domain,
+		Zone: domain.Zone,
+	}, nil
+}
+
+// lookupCustomDomainChallenge checks that the verification's challenge is published in the TXT record at its challenge
+// name
+func (b *backend) lookupCustomDomainChallenge(verification db.CustomDomainVerification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), verificationLookupTimeout)
+	defer cancel()
+
+	fqdn := customDomainChallengeLabel + "." + verification.Name
+	values, err := b.resolver.LookupTXT(ctx, fqdn)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return fmt.Errorf("%w: looking up the TXT record at %v failed: %v", ErrVerificationFailed, fqdn, dnsErr)
+	} else if err != nil {
+		return err
+	}
+
+	for _, v := range values {
+		if v == verification.Challenge {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: the TXT record at %v doesn't hold the challenge", ErrVerificationFailed, fqdn)
+}
+
+func (b *backend) purgeCustomDomainVerifications() {
+	deleted, err := b.db.PurgeOldCustomDomainVerifications(b.customDomainVerificationMaxAgeSeconds)
+	if err != nil {
+		logrus.Errorf("problem purging old custom domain verifications: %v", err)
+		return
+	}
+	logrus.Infof("Custom domain verifications purged from DB: %v", deleted)
+}
@@ -0,0 +1,203 @@
+package backend
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/acorn-io/acorn-dns/pkg/rand"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	keySigningKeyActive   = "ACTIVE"
+	zoneSignatureSigning  = "SIGNING"
+	keySigningKeyNameBase = "acorn_dns_"
+)
+
+// GetZoneDNSSEC returns the DNSSEC signing status of the served zone with the given name, along with the DS records of
+// its key-signing keys. Route53 signs zones itself, managing and rotating their zone-signing keys, and the key-signing
+// keys are backed by the configured KMS key, so acorn-dns never holds any key material.
+func (b *backend) GetZoneDNSSEC(zoneName string) (model.DNSSECResponse, error) {
+	z, err := b.dnssecZone(zoneName)
+	if err != nil {
+		return model.DNSSECResponse{}, err
+	}
+
+	out, err := b.Svc.GetDNSSEC(&route53.GetDNSSECInput{HostedZoneId: aws.String(z.id)})
+	if err != nil {
+		return model.DNSSECResponse{}, err
+	}
+
+	resp := model.DNSSECResponse{
+		Zone:           z.name,
+		Status:         aws.StringValue(out.Status.ServeSignature),
+		StatusMessage:  aws.StringValue(out.Status.StatusMessage),
+		KeySigningKeys: make([]model.KeySigningKey, 0, len(out.KeySigningKeys)),
+	}
+	for _, k := range out.KeySigningKeys {
+		resp.KeySigningKeys = append(resp.KeySigningKeys, model.KeySigningKey{
+			Name:     aws.StringValue(k.Name),
+			Status:   aws.StringValue(k.Status),
+			KeyTag:   aws.Int64Value(k.KeyTag),
+			DSRecord: aws.StringValue(k.DSRecord),
+		})
+	}
+	return resp, nil
+}
+
+// EnableZoneDNSSEC starts signing the zone, creating a key-signing key for it if it has no active one. The zone is only
+// validated by resolvers once the operator publishes the returned DS record in the parent zone.
+//
+// Only the served zones are signed, not the hosted zones of domains, whose records would be left unsigned behind the
+// signed delegation. Signing is therefore refused while domains get their own hosted zones. Domains that got theirs
+// before sub-zones were turned off keep them unsigned until they're purged.
+func (b *backend) EnableZoneDNSSEC(zoneName string) (model.DNSSECResponse, error) {
+	if b.subZones {
+		return model.DNSSECResponse{}, fmt.Errorf("%w: zones can't be signed while domains get their own hosted zones, which would not be signed", ErrConflict)
+	}
+
+	status, err := b.GetZoneDNSSEC(zoneName)
+	if err != nil {
+		return model.DNSSECResponse{}, err
+	}
+
+	hasActiveKey := false
+	for _, k := range status.KeySigningKeys {
+		if k.Status == keySigningKeyActive {
+			hasActiveKey = true
+		}
+	}
+	if !hasActiveKey {
+		if err := b.createKeySigningKey(zoneName); err != nil {
+			return model.DNSSECResponse{}, err
+		}
+	}
+
+	if status.Status != zoneSignatureSigning {
+		z, err := b.dnssecZone(zoneName)
+		if err != nil {
+			return model.DNSSECResponse{}, err
+		}
+		if _, err := b.Svc.EnableHostedZoneDNSSEC(&route53.EnableHostedZoneDNSSECInput{HostedZoneId: aws.String(z.id)}); err != nil {
+			return model.DNSSECResponse{}, fmt.Errorf("failed to enable DNSSEC signing of zone %v with error %v", zoneName, err)
+		}
+		logrus.Infof("Enabled DNSSEC signing of zone %v", zoneName)
+	}
+
+	return b.GetZoneDNSSEC(zoneName)
+}
+
+// DisableZoneDNSSEC stops signing the zone. The zone's DS record must be removed from the parent zone first, or the zone
+// will fail to validate. Its key-signing keys are kept.
+func (b *backend) DisableZoneDNSSEC(zoneName string) (model.DNSSECResponse, error) {
+	z, err := b.dnssecZone(zoneName)
+	if err != nil {
+		return model.DNSSECResponse{}, err
+	}
+
+	if _, err := b.Svc.DisableHostedZoneDNSSEC(&route53.DisableHostedZoneDNSSECInput{HostedZoneId: aws.String(z.id)}); err != nil {
+		return model.DNSSECResponse{}, fmt.Errorf("failed to disable DNSSEC signing of zone %v with error %v", zoneName, err)
+	}
+	logrus.Infof("Disabled DNSSEC signing of zone %v", zoneName)
+
+	return b.GetZoneDNSSEC(zoneName)
+}
+
+// RotateZoneKeySigningKey adds a new active key-signing key to the zone, next to the existing ones. Once its DS record is
+// published in the parent zone and the old DS record has expired from caches, the old key can be deleted. This can't be
+// done on a schedule, since only the operator can publish DS records in the parent zone.
+func (b *backend) RotateZoneKeySigningKey(zoneName string) (model.DNSSECResponse, error) {
+	if err := b.createKeySigningKey(zoneName); err != nil {
+		return model.DNSSECResponse{}, err
+	}
+	return b.GetZoneDNSSEC(zoneName)
+}
+
+// DeleteZoneKeySigningKey deactivates and deletes one of the zone's key-signing keys. The zone's last active key can't
+// be deleted while the zone is signed.
+func (b *backend) DeleteZoneKeySigningKey(zoneName, keyName string) (model.DNSSECResponse, error) {
+	status, err := b.GetZoneDNSSEC(zoneName)
+	if err != nil {
+		return model.DNSSECResponse{}, err
+	}
+
+	var key *model.KeySigningKey
+	activeKeys := 0
+	for i, k := range status.KeySigningKeys {
+		if k.Name == keyName {
+			key = &status.KeySigningKeys[i]
+		}
+		if k.Status == keySigningKeyActive {
+			activeKeys++
+		}
+	}
+	if key == nil {
+		return model.DNSSECResponse{}, fmt.Errorf("%w: zone %v has no key-signing key %v", ErrNotFound, zoneName, keyName)
+	}
+	if key.Status == keySigningKeyActive && activeKeys == 1 && status.Status == zoneSignatureSigning {
+		return model.DNSSECResponse{}, fmt.Errorf("%w: %v is the only active key-signing key of zone %v", ErrConflict, keyName, zoneName)
+	}
+
+	z, err := b.dnssecZone(zoneName)
+	if err != nil {
+		return model.DNSSECResponse{}, err
+	}
+	if key.Status == keySigningKeyActive {
+		_, err := b.Svc.DeactivateKeySigningKey(&route53.DeactivateKeySigningKeyInput{
+			HostedZoneId: aws.String(z.id),
+			Name:         aws.String(keyName),
+		})
+		if err != nil {
+			return model.DNSSECResponse{}, fmt.Errorf("failed to deactivate key-signing key %v with error %v", keyName, err)
+		}
+	}
+	_, err = b.Svc.DeleteKeySigningKey(&route53.DeleteKeySigningKeyInput{
+		HostedZoneId: aws.String(z.id),
+		Name:         aws.String(keyName),
+	})
+	if err != nil {
+		return model.DNSSECResponse{}, fmt.Errorf("failed to delete key-signing key %v with error %v", keyName, err)
+	}
+	logrus.Infof("Deleted key-signing key %v of zone %v", keyName, zoneName)
+
+	return b.GetZoneDNSSEC(zoneName)
+}
+
+func (b *backend) createKeySigningKey(zoneName string) error {
+	if b.dnssecKMSKeyARN == "" {
+		return fmt.Errorf("%w: no KMS key is configured for DNSSEC signing", ErrConflict)
+	}
+
+	z, err := b.dnssecZone(zoneName)
+	if err != nil {
+		return err
+	}
+
+	// Keys created within the same second, such as by concurrent rotations, are told apart by the random suffix
+	now := time.Now()
+	name := fmt.Sprintf("%v%v_%v", keySigningKeyNameBase, now.Unix(), rand.StringWithSmall(8))
+	_, err = b.Svc.CreateKeySigningKey(&route53.CreateKeySigningKeyInput{
+		HostedZoneId:            aws.String(z.id),
+		KeyManagementServiceArn: aws.String(b.dnssecKMSKeyARN),
+		Name:                    aws.String(name),
+		Status:                  aws.String(keySigningKeyActive),
+		CallerReference:         aws.String(fmt.Sprintf("acorn-dns-%v-%v", name, now.UnixNano())),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create key-signing key for zone %v with error %v", zoneName, err)
+	}
+	logrus.Infof("Created key-signing key %v for zone %v", name, zoneName)
+	return nil
+}
+
+// dnssecZone returns the served zone with the given name, including the ones that hold custom domains
+func (b *backend) dnssecZone(zoneName string) (zone, error) {
+	z, err := b.servedZone(zoneName)
+	if err != nil {
+		return zone{}, fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return z, nil
+}
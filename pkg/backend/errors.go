@@ -0,0 +1,61 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// These errors are wrapped by the backend to signal that a request failed because of what was asked for, rather than
+// because of a server side problem. Callers can check for them with errors.Is.
+var (
+	ErrInvalidRecord = errors.New("invalid record")
+	ErrNotFound      = errors.New("not found")
+	ErrConflict      = errors.New("conflict")
+	// ErrPreconditionFailed means the record changed since the caller last read it
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrQuotaExceeded means the request would take the domain over one of its quotas
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrInvalidSlug means a requested slug can't be used
+	ErrInvalidSlug = errors.New("invalid slug")
+	// ErrInvalidZone means a requested zone isn't one of the zones that are served
+	ErrInvalidZone = errors.New("invalid zone")
+	// ErrVerificationFailed means a custom domain's challenge couldn't be found
+	ErrVerificationFailed = errors.New("verification failed")
+	// ErrInvalidWebhook means a webhook subscription's URL or events are invalid
+	ErrInvalidWebhook = errors.New("invalid webhook")
+	// ErrForbidden means the caller isn't allowed to do what was requested
+	ErrForbidden = errors.New("forbidden")
+	// ErrRateLimited is wrapped by RateLimitError
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// RateLimitError is returned when a request is refused by a rate limit. RetryAfter is how long until it would be allowed.
+type RateLimitError struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrRateLimited, e.Message)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// BatchError is returned when operations of a batch fail validation, in which case none of the batch is applied.
+// Errors has an entry for every operation, which is nil for the operations that were valid.
+type BatchError struct {
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	var failed int
+	for _, err := range e.Errors {
+		if err != nil {
+			failed++
+		}
+	}
+	return fmt.Sprintf("%v of %v operations in the batch are invalid", failed, len(e.Errors))
+}
@@ -0,0 +1,219 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+)
+
+// maxChangesPerBatch keeps change batches well under Route53's limit of 1,000 changes
+const maxChangesPerBatch = 500
+
+// DomainExpiry returns when the domain expires, which is when it stops resolving, and when its grace period ends, which
+// is when it's purged. It returns nil for a domain that never expires.
+func (b *backend) DomainExpiry(domain db.Domain) *model.DomainExpiry {
+	if domain.NeverExpires {
+		return nil
+	}
+
+	expiresAt := domain.LastCheckIn.Add(time.Duration(b.domainMaxAgeSeconds) * time.Second)
+	graceEndsAt := expiresAt.Add(time.Duration(b.domainGracePeriodSeconds) * time.Second)
+
+	expiry := model.DomainExpiry{
+		Status:      model.DomainStatusActive,
+		ExpiresAt:   expiresAt.UTC().Format(time.RFC3339),
+		GraceEndsAt: graceEndsAt.UTC().Format(time.RFC3339),
+	}
+	if domain.SuspendedAt != nil {
+		expiry.Status = model.DomainStatusGrace
+	} else if remaining := time.Until(expiresAt); remaining > 0 {
+		expiry.DaysRemaining = int64(remaining / (24 * time.Hour))
+	}
+	return &expiry
+}
+
+// suspendExpiredDomains removes the records of domains that have expired from their zones, which starts their grace
+// period. The records are kept in the database, so that they can be restored if the domain is renewed in time. Records
+// are purged once they go unrenewed for the record max age, though, which by default is much shorter than the domain
+// max age, so an expired domain usually has none left.
+func (b *backend) suspendExpiredDomains() {
+	domains, err := b.db.GetDomainsNotRenewedSince(time.Now().Add(-time.Duration(b.domainMaxAgeSeconds) * time.Second))
+	if err != nil {
+		logrus.Errorf("Could not load expired domains from database. Error: %v", err)
+		return
+	}
+
+	var suspended int
+	for _, domain := range domains {
+		if domain.SuspendedAt != nil {
+			continue
+		}
+		if err := b.suspendDomain(domain); err != nil {
+			logrus.Errorf("Unable to suspend expired domain %v. Error: %v", domain.Domain, err)
+			continue
+		}
+		suspended++
+		b.emit(domain.ID, domain.Domain, model.EventDomainSuspended, model.DomainResponse{Name: domain.Domain, Zone: domain.Zone})
+	}
+	logrus.Infof("Expired domains suspended: %v", suspended)
+}
+
+func (b *backend) suspendDomain(domain db.Domain) error {
+	recs, err := b.db.GetDomainRecords(domain.ID)
+	if err != nil {
+		return err
+	}
+	records := maps.Values(recs)
+
+	if len(records) > 0 {
+		z, err := b.domainZone(domain.ID)
+		if err != nil {
+			return err
+		}
+		if err := b.deleteRecordSets(z, records); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	if err := b.db.SetDomainSuspended(domain.ID, &now); err != nil {
+		return err
+	}
+	b.audit(model.Actor{}, domain.ID, domain.Domain, model.AuditDomainSuspend, records, nil, "")
+	return nil
+}
+
+// resumeDomain puts whichever records of a suspended domain haven't been purged back in its zone and ends its grace
+// period
+func (b *backend) resumeDomain(domain db.Domain, actor model.Actor) error {
+	recs, err := b.db.GetDomainRecords(domain.ID)
+	if err != nil {
+		return err
+	}
+	records := maps.Values(recs)
+
+	z, err := b.domainZone(domain.ID)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(records); start += maxChangesPerBatch {
+		end := start + maxChangesPerBatch
+		if end > len(records) {
+			end = len(records)
+		}
+
+		if err := b.changeRecordSets(z, "UPSERT", records[start:end]); err != nil {
+			return fmt.Errorf("failed to restore route53 records of domain %v with error %v", domain.Domain, err)
+		}
+	}
+
+	if err := b.db.SetDomainSuspended(domain.ID, nil); err != nil {
+		return err
+	}
+	b.audit(actor, domain.ID, domain.Domain, model.AuditDomainResume, nil, records, "")
+	return nil
+}
+
+// deleteRecordSets deletes the records' record sets from the zone. Record sets that are already gone, which makes
+// Route53 reject the change batch that deletes them, are skipped.
+func (b *backend) deleteRecordSets(z zone, records []db.Record) error {
+	for start := 0; start < len(records); start += maxChangesPerBatch {
+		end := start + maxChangesPerBatch
+		if end > len(records) {
+			end = len(records)
+		}
+
+		batch := records[start:end]
+		if err := b.changeRecordSets(z, "DELETE", batch); err == nil {
+			continue
+		} else if !isRecordSetMismatch(err) {
+			return err
+		}
+
+		// Find the ones that are already gone by deleting them one at a time
+		for _, record := range batch {
+			if err := b.changeRecordSets(z, "DELETE", []db.Record{record}); err != nil && !isRecordSetMismatch(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *backend) changeRecordSets(z zone, action string, records []db.Record) error {
+	changes := make([]*route53.Change, 0, len(records))
+	for _, record := range records {
+		changes = append(changes, &route53.Change{
+			Action:            aws.String(action),
+			ResourceRecordSet: b.resourceRecordSet(record),
+		})
+	}
+	_, err := b.Svc.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(z.id),
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: changes,
+		},
+	})
+	return err
+}
+
+func isInvalidChangeBatch(err error) bool {
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == route53.ErrCodeInvalidChangeBatch
+}
+
+// isRecordSetMismatch reports whether Route53 rejected a change batch only because a record set it creates already
+// exists or one it deletes is missing or has different values, meaning the record sets were changed since they were
+// read. Route53 rejects invalid changes, such as bad values, with the same error code, and retrying won't fix those.
+func isRecordSetMismatch(err error) bool {
+	messages := changeBatchMessages(err)
+	if len(messages) == 0 {
+		return false
+	}
+	for _, message := range messages {
+		if !strings.Contains(message, "already exists") && !strings.Contains(message, "not found") &&
+			!strings.Contains(message, "values provided do not match") {
+			return false
+		}
+	}
+	return true
+}
+
+// invalidChangeBatchError describes a change batch that Route53 rejected as invalid, so that it's reported to clients
+// as an invalid request rather than an internal error
+func invalidChangeBatchError(err error) error {
+	return fmt.Errorf("%w: %v", ErrInvalidRecord, strings.Join(changeBatchMessages(err), "; "))
+}
+
+// changeBatchMessages returns the reasons Route53 gave for rejecting a change batch, one per rejected change
+func changeBatchMessages(err error) []string {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) || aerr.Code() != route53.ErrCodeInvalidChangeBatch {
+		return nil
+	}
+
+	var messages []string
+	var batchErr awserr.BatchedErrors
+	if errors.As(err, &batchErr) {
+		for _, origErr := range batchErr.OrigErrs() {
+			var changeErr awserr.Error
+			if errors.As(origErr, &changeErr) && changeErr.Message() != "" {
+				messages = append(messages, changeErr.Message())
+			}
+		}
+	}
+	if len(messages) == 0 {
+		messages = append(messages, aerr.Message())
+	}
+	return messages
+}
@@ -0,0 +1,80 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+)
+
+func TestDomainExpiry(t *testing.T) {
+	const day = 24 * time.Hour
+	b := &backend{
+		domainMaxAgeSeconds:      int64(30 * day / time.Second),
+		domainGracePeriodSeconds: int64(7 * day / time.Second),
+	}
+	lastCheckIn := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	suspendedAt := lastCheckIn.Add(31 * day)
+
+	tests := []struct {
+		name   string
+		domain db.Domain
+		want   *model.DomainExpiry
+	}{
+		{
+			name:   "never expires",
+			domain: db.Domain{LastCheckIn: lastCheckIn, NeverExpires: true},
+		},
+		{
+			name:   "suspended",
+			domain: db.Domain{LastCheckIn: lastCheckIn, SuspendedAt: &suspendedAt},
+			want: &model.DomainExpiry{
+				Status:      model.DomainStatusGrace,
+				ExpiresAt:   "2023-01-31T12:00:00Z",
+				GraceEndsAt: "2023-02-07T12:00:00Z",
+			},
+		},
+		{
+			name:   "expired but not suspended yet",
+			domain: db.Domain{LastCheckIn: lastCheckIn},
+			want: &model.DomainExpiry{
+				Status:      model.DomainStatusActive,
+				ExpiresAt:   "2023-01-31T12:00:00Z",
+				GraceEndsAt: "2023-02-07T12:00:00Z",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := b.DomainExpiry(tt.domain)
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Errorf("DomainExpiry() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomainExpiryDaysRemaining(t *testing.T) {
+	const day = 24 * time.Hour
+	b := &backend{domainMaxAgeSeconds: int64(30 * day / time.Second)}
+
+	tests := []struct {
+		name        string
+		checkedInAt time.Duration
+		want        int64
+	}{
+		{name: "just renewed", checkedInAt: 0, want: 29},
+		{name: "half way", checkedInAt: -15*day - day/2, want: 14},
+		{name: "last day", checkedInAt: -29*day - day/2, want: 0},
+		{name: "expired", checkedInAt: -31 * day, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := b.DomainExpiry(db.Domain{LastCheckIn: time.Now().Add(tt.checkedInAt)})
+			if got.Status != model.DomainStatusActive || got.DaysRemaining != tt.want {
+				t.Errorf("DomainExpiry() = %+v, want status %v with %v days remaining", got, model.DomainStatusActive, tt.want)
+			}
+		})
+	}
+}
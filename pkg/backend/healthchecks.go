@@ -0,0 +1,280 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/acorn-io/acorn-dns/pkg/rand"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	defaultFailureThreshold = 3
+	defaultRequestInterval  = 30
+)
+
+func (b *backend) CreateHealthCheck(domain string, domainID uint, input model.HealthCheckRequest) (model.HealthCheckResponse, error) {
+	fqdn := input.Record + domain
+
+	records, err := b.db.GetDomainRecordsByFQDN(fqdn, domainID)
+	if err != nil {
+		return model.HealthCheckResponse{}, err
+	}
+	var record db.Record
+	for _, r := range records {
+		if r.Type == model.RecordTypeA && r.SetIdentifier == input.SetIdentifier {
+			record = r
+		}
+	}
+	if record.ID == 0 {
+		return model.HealthCheckResponse{}, fmt.Errorf("%w: %v has no A record to check", ErrNotFound, fqdn)
+	}
+
+	values := record.ValueStrings()
+	if input.IPAddress == "" {
+		if len(values) != 1 {
+			return model.HealthCheckResponse{}, fmt.Errorf("%w: %v has %v values, so the address to check must be given",
+				ErrInvalidRecord, fqdn, len(values))
+		}
+		input.IPAddress = values[0]
+	} else if !slices.Contains(values, input.IPAddress) {
+		return model.HealthCheckResponse{}, fmt.Errorf("%w: %v is not a value of %v", ErrInvalidRecord, input.IPAddress, fqdn)
+	}
+
+	if input.Port == 0 {
+		switch input.Type {
+		case model.HealthCheckTypeHTTP:
+			input.Port = 80
+		case model.HealthCheckTypeHTTPS:
+			input.Port = 443
+		}
+	}
+	if input.FailureThreshold == 0 {
+		input.FailureThreshold = defaultFailureThreshold
+	}
+	if input.RequestInterval == 0 {
+		input.RequestInterval = defaultRequestInterval
+	}
+
+	config := &route53.HealthCheckConfig{
+		Type:             aws.String(input.Type),
+		IPAddress:        aws.String(input.IPAddress),
+		Port:             aws.Int64(input.Port),
+		FailureThreshold: aws.Int64(input.FailureThreshold),
+		RequestInterval:  aws.Int64(input.RequestInterval),
+	}
+	if input.Type != model.HealthCheckTypeTCP {
+		// The FQDN is sent as the Host header (and as the SNI server name for HTTPS), while the connection goes to the IP
+		config.FullyQualifiedDomainName = aws.String(fqdn)
+		if input.ResourcePath != "" {
+			config.ResourcePath = aws.String(input.ResourcePath)
+		}
+		if input.Type == model.HealthCheckTypeHTTPS {
+			config.EnableSNI = aws.Bool(true)
+		}
+	}
+
+	out, err := b.Svc.CreateHealthCheck(&route53.CreateHealthCheckInput{
+		CallerReference:   aws.String(rand.StringWithAll(32)),
+		HealthCheckConfig: config,
+	})
+	if err != nil {
+		return model.HealthCheckResponse{}, fmt.Errorf("failed to create route53 health check for %v with error %v", fqdn, err)
+	}
+	providerID := aws.StringValue(out.HealthCheck.Id)
+
+	// The Name tag is what the AWS console displays for the health check. It's only a convenience, so failing to set
+	// it isn't fatal.
+	if _, err := b.Svc.ChangeTagsForResource(&route53.ChangeTagsForResourceInput{
+		ResourceId:   aws.String(providerID),
+		ResourceType: aws.String(route53.TagResourceTypeHealthcheck),
+		AddTags:      []*route53.Tag{{Key: aws.String("Name"), Value: aws.String(fqdn)}},
+	}); err != nil {
+		logrus.Warnf("failed to tag route53 health check %v: %v", providerID, err)
+	}
+
+	healthCheck, err := b.db.CreateHealthCheck(db.HealthCheck{
+		ProviderID:       providerID,
+		DomainID:         domainID,
+		RecordID:         record.ID,
+		FQDN:             fqdn,
+		SetIdentifier:    input.SetIdentifier,
+		Type:             input.Type,
+		IPAddress:        input.IPAddress,
+		Port:             input.Port,
+		ResourcePath:     input.ResourcePath,
+		FailureThreshold: input.FailureThreshold,
+		RequestInterval:  input.RequestInterval,
+	})
+	if err != nil {
+		if err := b.deleteProviderHealthCheck(providerID); err != nil {
+			logrus.Errorf("failed to clean up route53 health check %v: %v", providerID, err)
+		}
+		return model.HealthCheckResponse{}, err
+	}
+
+	resp := healthCheckResponse(healthCheck)
+	// A new health check has no observations yet
+	resp.Status = model.HealthStatusUnknown
+	return resp, nil
+}
+
+func (b *backend) GetHealthChecks(domainID uint) ([]model.HealthCheckResponse, error) {
+	healthChecks, err := b.db.GetHealthChecks(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]model.HealthCheckResponse, 0, len(healthChecks))
+	for _, hc := range healthChecks {
+		r := healthCheckResponse(hc)
+		r.Status = b.healthStatus(hc.ProviderID)
+		resp = append(resp, r)
+	}
+	return resp, nil
+}
+
+func (b *backend) GetHealthCheck(domainID uint, id string) (model.HealthCheckResponse, error) {
+	healthCheck, err := b.db.GetHealthCheck(domainID, id)
+	if err != nil {
+		return model.HealthCheckResponse{}, err
+	}
+	if healthCheck.ID == 0 {
+		return model.HealthCheckResponse{}, fmt.Errorf("%w: health check %v", ErrNotFound, id)
+	}
+
+	resp := healthCheckResponse(healthCheck)
+	resp.Status = b.healthStatus(healthCheck.ProviderID)
+	return resp, nil
+}
+
+func (b *backend) DeleteHealthCheck(domainID uint, id string) error {
+	healthCheck, err := b.db.GetHealthCheck(domainID, id)
+	if err != nil {
+		return err
+	}
+	if healthCheck.ID == 0 {
+		return fmt.Errorf("%w: health check %v", ErrNotFound, id)
+	}
+
+	// Route53 refuses to delete a health check that record sets refer to, so the records have to go, or stop referring
+	// to it, first
+	records, err := b.db.GetHealthCheckRecords(healthCheck.ProviderID)
+	if err != nil {
+		return err
+	}
+	if len(records) > 0 {
+		names := make([]string, 0, len(records))
+		for _, record := range records {
+			name := record.FQDN + " " + record.Type
+			if record.SetIdentifier != "" {
+				name += " " + record.SetIdentifier
+			}
+			names = append(names, name)
+		}
+		return fmt.Errorf("%w: health check %v is used by records %v", ErrConflict, id, strings.Join(names, ", "))
+	}
+
+	err = b.deleteHealthChecks([]db.HealthCheck{healthCheck})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == route53.ErrCodeHealthCheckInUse {
+		// A record set outside of the database, or one created since it was checked, refers to it
+		return fmt.Errorf("%w: health check %v is in use", ErrConflict, id)
+	}
+	return err
+}
+
+// deleteRecordsHealthChecks deletes the health checks bound to records, which have been deleted. Callers only log its
+// errors, since purgeOrphanedHealthChecks deletes whatever is left of the health checks.
+func (b *backend) deleteRecordsHealthChecks(records []db.Record) error {
+	healthChecks, err := b.db.GetRecordsHealthChecks(records)
+	if err != nil {
+		return err
+	}
+	return b.deleteHealthChecks(healthChecks)
+}
+
+// purgeOrphanedHealthChecks deletes the health checks whose records have been purged
+func (b *backend) purgeOrphanedHealthChecks() {
+	healthChecks, err := b.db.GetOrphanedHealthChecks()
+	if err != nil {
+		logrus.Errorf("Could not load orphaned health checks from database. Error: %v", err)
+		return
+	}
+
+	if err := b.deleteHealthChecks(healthChecks); err != nil {
+		logrus.Errorf("Unable to delete orphaned health checks. Error: %v", err)
+		return
+	}
+	logrus.Infof("Health checks purged: %v", len(healthChecks))
+}
+
+func (b *backend) deleteHealthChecks(healthChecks []db.HealthCheck) error {
+	for _, hc := range healthChecks {
+		if err := b.deleteProviderHealthCheck(hc.ProviderID); err != nil {
+			return fmt.Errorf("failed to delete route53 health check %v with error %w", hc.ProviderID, err)
+		}
+	}
+	return b.db.DeleteHealthChecks(healthChecks)
+}
+
+func (b *backend) deleteProviderHealthCheck(providerID string) error {
+	_, err := b.Svc.DeleteHealthCheck(&route53.DeleteHealthCheckInput{
+		HealthCheckId: aws.String(providerID),
+	})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == route53.ErrCodeNoSuchHealthCheck {
+		// Already gone, which is what we wanted
+		return nil
+	}
+	return err
+}
+
+// healthStatus summarizes the observations of Route53's health checkers. Like Route53 itself, the endpoint is considered
+// healthy when more than half of the checkers report success.
+func (b *backend) healthStatus(providerID string) string {
+	out, err := b.Svc.GetHealthCheckStatus(&route53.GetHealthCheckStatusInput{
+		HealthCheckId: aws.String(providerID),
+	})
+	if err != nil {
+		logrus.Warnf("failed to get status of route53 health check %v: %v", providerID, err)
+		return model.HealthStatusUnknown
+	}
+	if len(out.HealthCheckObservations) == 0 {
+		return model.HealthStatusUnknown
+	}
+
+	var healthy int
+	for _, o := range out.HealthCheckObservations {
+		if o.StatusReport != nil && strings.HasPrefix(aws.StringValue(o.StatusReport.Status), "Success") {
+			healthy++
+		}
+	}
+	if healthy*2 > len(out.HealthCheckObservations) {
+		return model.HealthStatusHealthy
+	}
+	return model.HealthStatusUnhealthy
+}
+
+func healthCheckResponse(hc db.HealthCheck) model.HealthCheckResponse {
+	return model.HealthCheckResponse{
+		HealthCheckRequest: model.HealthCheckRequest{
+			SetIdentifier:    hc.SetIdentifier,
+			Type:             hc.Type,
+			IPAddress:        hc.IPAddress,
+			Port:             hc.Port,
+			ResourcePath:     hc.ResourcePath,
+			FailureThreshold: hc.FailureThreshold,
+			RequestInterval:  hc.RequestInterval,
+		},
+		ID:   hc.ProviderID,
+		FQDN: hc.FQDN,
+	}
+}
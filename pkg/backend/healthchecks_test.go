@@ -0,0 +1,60 @@
+package backend
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+)
+
+func TestDeleteHealthCheckInUse(t *testing.T) {
+	b := newTestBackend(t)
+	domain, err := b.db.CreateSubDomainWithSlug("hash", "example.com", "abc123", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hc := range []db.HealthCheck{
+		{ProviderID: "hc-used", DomainID: domain.ID, FQDN: "www" + domain.Domain, Type: "A"},
+		{ProviderID: "hc-other", DomainID: domain.ID, FQDN: "api" + domain.Domain, Type: "A"},
+	} {
+		if _, err := b.db.CreateHealthCheck(hc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, record := range []db.Record{
+		{FQDN: "www" + domain.Domain, Type: "A", DomainID: domain.ID, SetIdentifier: "primary", RoutingPolicy: "failover", Failover: "PRIMARY", HealthCheckID: "hc-used", Values: db.NewRecordValues([]string{"1.1.1.1"})},
+		{FQDN: "www" + domain.Domain, Type: "A", DomainID: domain.ID, SetIdentifier: "secondary", RoutingPolicy: "failover", Failover: "SECONDARY", Values: db.NewRecordValues([]string{"2.2.2.2"})},
+	} {
+		if _, err := b.db.PersistRecord(record, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		domainID uint
+		id       string
+		wantErr  error
+		wantMsg  string
+	}{
+		{name: "used by a record", domainID: domain.ID, id: "hc-used", wantErr: ErrConflict, wantMsg: "www" + domain.Domain + " A primary"},
+		{name: "another domain's", domainID: domain.ID + 1, id: "hc-used", wantErr: ErrNotFound},
+		{name: "unknown", domainID: domain.ID, id: "hc-unknown", wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := b.DeleteHealthCheck(tt.domainID, tt.id)
+			if !errors.Is(err, tt.wantErr) || !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Fatalf("DeleteHealthCheck() error = %v, want %v mentioning %q", err, tt.wantErr, tt.wantMsg)
+			}
+			healthCheck, err := b.db.GetHealthCheck(domain.ID, "hc-used")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if healthCheck.ID == 0 {
+				t.Error("health check in use was deleted")
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package backend
+
+import (
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/sirupsen/logrus"
+)
+
+// BeginIdempotentRequest claims an idempotency key for a request. If the key was already claimed within the retention
+// window, the existing key is returned instead, holding the response to replay once its request has been handled.
+func (b *backend) BeginIdempotentRequest(scope, key, requestHash string) (db.IdempotencyKey, bool, error) {
+	return b.db.CreateIdempotencyKey(db.IdempotencyKey{
+		Scope:       scope,
+		Key:         key,
+		RequestHash: requestHash,
+	}, b.idempotencyKeyMaxAgeSeconds)
+}
+
+// CompleteIdempotentRequest stores the response to the request that claimed key
+func (b *backend) CompleteIdempotentRequest(key db.IdempotencyKey) error {
+	return b.db.SaveIdempotencyKey(key)
+}
+
+// AbandonIdempotentRequest releases key without storing a response, so that a retry of the request is handled again
+func (b *backend) AbandonIdempotentRequest(key db.IdempotencyKey) error {
+	return b.db.DeleteIdempotencyKey(key)
+}
+
+func (b *backend) purgeIdempotencyKeys() {
+	deleted, err := b.db.PurgeOldIdempotencyKeys(b.idempotencyKeyMaxAgeSeconds)
+	if err != nil {
+		logrus.Errorf("problem purging old idempotency keys: %v", err)
+		return
+	}
+	logrus.Infof("Idempotency keys purged from DB: %v", deleted)
+}
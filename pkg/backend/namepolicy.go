@@ -0,0 +1,79 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/acorn-io/acorn-dns/pkg/policy"
+)
+
+func (b *backend) GetNameRules() ([]model.NameRule, error) {
+	rules, err := b.db.GetNameRules()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]model.NameRule, 0, len(rules))
+	for _, r := range rules {
+		resp = append(resp, nameRule(r))
+	}
+	return resp, nil
+}
+
+func (b *backend) CreateNameRule(rule model.NameRule) (model.NameRule, error) {
+	r, err := b.db.CreateNameRule(db.NameRule{
+		Kind:    rule.Kind,
+		Pattern: rule.Pattern,
+		Regex:   rule.Regex,
+	})
+	if err != nil {
+		return model.NameRule{}, err
+	}
+	return nameRule(r), nil
+}
+
+func (b *backend) DeleteNameRule(id uint) error {
+	deleted, err := b.db.DeleteNameRule(id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("%w: name rule %v", ErrNotFound, id)
+	}
+	return nil
+}
+
+// operatorRules returns the rules managed by operators as they are now, compiled for the name policy's checks
+func (b *backend) operatorRules() (policy.Rules, error) {
+	rules, err := b.GetNameRules()
+	if err != nil {
+		return policy.Rules{}, err
+	}
+	return policy.Compile(rules), nil
+}
+
+// recordNameChecker returns a function that checks record names against the name policy, including the rules managed
+// by operators as they are now
+func (b *backend) recordNameChecker() (func(name string) error, error) {
+	rules, err := b.operatorRules()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(name string) error {
+		if err := b.policy.CheckRecordName(name, rules); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+		}
+		return nil
+	}, nil
+}
+
+func nameRule(r db.NameRule) model.NameRule {
+	return model.NameRule{
+		ID:      r.ID,
+		Kind:    r.Kind,
+		Pattern: r.Pattern,
+		Regex:   r.Regex,
+	}
+}
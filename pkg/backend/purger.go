@@ -4,6 +4,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/acorn-io/acorn-dns/pkg/db"
 	"github.com/acorn-io/acorn-dns/pkg/model"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/route53"
@@ -15,41 +16,75 @@ import (
 func (b *backend) StartPurgerDaemon(stopCh <-chan struct{}) {
 	logrus.Infof("starting purge daemon. Purge interval: %v, max domain age: %v, record max age: %v",
 		b.purgeIntervalSeconds, b.domainMaxAgeSeconds, b.recordMaxAgeSeconds)
+	// Expired values, such as ACME challenges, are short-lived so they are removed much more often than records are purged
+	go wait.Until(b.expireACMEChallenges, time.Minute, stopCh)
+	go wait.Until(b.deliverWebhooks, webhookDeliveryInterval, stopCh)
 	wait.JitterUntil(b.purge, time.Duration(b.purgeIntervalSeconds)*time.Second, .002, true, stopCh)
 }
 
 func (b *backend) purge() {
 	logrus.Infof("Beginning purge ☠️")
 
-	domainDeleted, recordsDeleted, err := b.db.PurgeOldDomainsAndRecords(b.domainMaxAgeSeconds, b.recordMaxAgeSeconds)
+	// Domains are only purged once their grace period ends
+	domainsDeleted, recordsDeleted, err := b.db.PurgeOldDomainsAndRecords(b.domainMaxAgeSeconds+b.domainGracePeriodSeconds,
+		b.recordMaxAgeSeconds)
 	if err != nil {
 		logrus.Errorf("problem purging old domains: %v", err)
 	}
-	logrus.Infof("Domains purged from DB: %v", domainDeleted)
-	logrus.Infof("Records purged from DB: %v", recordsDeleted)
+	logrus.Infof("Domains purged from DB: %v", len(domainsDeleted))
+	logrus.Infof("Records purged from DB: %v", len(recordsDeleted))
+	b.emitPurged(domainsDeleted, recordsDeleted)
+	b.suspendExpiredDomains()
+	b.emitExpiring()
+
+	b.purgeIdempotencyKeys()
+	b.purgeRateLimitBuckets()
+	b.purgeCustomDomainVerifications()
+	b.purgeDeletedDomains()
+	b.purgeWebhookSubscriptions()
+	b.purgeAuditLog()
+
+	// Health checks of purged records are only deleted after the records themselves, since a record set referencing a
+	// missing health check would be treated as healthy in the meantime anyway
+	defer b.purgeOrphanedHealthChecks()
+
+	for _, z := range b.zones {
+		b.purgeZone(z)
+	}
+
+	// Domains keep their own hosted zones until they're deleted, even if new domains no longer get them
+	b.teardownSubZones()
+	b.purgeSubZoneRecords(recordsDeleted)
+}
 
+// purgeZone deletes the records in the zone that are either not in the database or too old
+func (b *backend) purgeZone(z zone) {
 	input := &route53.ListResourceRecordSetsInput{
-		HostedZoneId: aws.String(b.ZoneID),
+		HostedZoneId: aws.String(z.id),
 	}
 
 	recordsToDelete := make(map[model.FQDNTypePair]*route53.ResourceRecordSet)
-	err = b.Svc.ListResourceRecordSetsPages(input,
+	err := b.Svc.ListResourceRecordSetsPages(input,
 		func(page *route53.ListResourceRecordSetsOutput, lastPage bool) bool {
 			currentPageRecords := make(map[model.FQDNTypePair]*route53.ResourceRecordSet)
 			pairsToQuery := make(map[model.FQDNTypePair]bool)
 			for _, recordSet := range page.ResourceRecordSets {
-				if aws.StringValue(recordSet.Type) != model.RecordTypeA &&
-					aws.StringValue(recordSet.Type) != model.RecordTypeCname &&
-					aws.StringValue(recordSet.Type) != model.RecordTypeTxt {
+				rType := aws.StringValue(recordSet.Type)
+				if recordSet.AliasTarget != nil && rType == model.RecordTypeA {
+					// Alias records are persisted under their own type
+					rType = model.RecordTypeAlias
+				}
+				if !isPurgeableRecordType(rType) {
 					continue
 				}
 
 				cleanedName := strings.Replace(aws.StringValue(recordSet.Name), "\\052", "*", 1)
 				recordSet.Name = aws.String(cleanedName)
-				// key is name (fqdn) + type
+				// key is name (fqdn) + type + set identifier
 				pair := model.FQDNTypePair{
-					FQDN: strings.TrimSuffix(aws.StringValue(recordSet.Name), "."),
-					Type: aws.StringValue(recordSet.Type),
+					FQDN:          strings.TrimSuffix(aws.StringValue(recordSet.Name), "."),
+					Type:          rType,
+					SetIdentifier: aws.StringValue(recordSet.SetIdentifier),
 				}
 				currentPageRecords[pair] = recordSet
 				pairsToQuery[pair] = true
@@ -70,16 +105,21 @@ func (b *backend) purge() {
 			return true
 		})
 	if err != nil {
-		logrus.Errorf("Error communicating with Route53: %v", err)
+		logrus.Errorf("Error communicating with Route53 about zone %v: %v", z.name, err)
 		return
 	}
 
 	// Ensure we don't remove records with the following suffixes.
 	exceptionSuffixes := []string{
-		".local." + b.baseDomain, // "local" FQDNs
-		"_psl." + b.baseDomain,   // public suffix list
+		".local." + z.name, // "local" FQDNs
+		"_psl." + z.name,   // public suffix list
 	}
 	for pair := range recordsToDelete {
+		// Records on the zone's domain itself (such as its own MX or CAA records) are never created through the API
+		if pair.FQDN == z.name {
+			delete(recordsToDelete, pair)
+			continue
+		}
 		for _, exception := range exceptionSuffixes {
 			if strings.HasSuffix(pair.FQDN, exception) {
 				delete(recordsToDelete, pair)
@@ -88,7 +128,7 @@ func (b *backend) purge() {
 	}
 
 	if len(recordsToDelete) == 0 {
-		logrus.Infof("Records purged from Route53: 0")
+		logrus.Infof("Records purged from Route53 zone %v: 0", z.name)
 		return
 	}
 
@@ -102,15 +142,100 @@ func (b *backend) purge() {
 	}
 
 	changeInput := &route53.ChangeResourceRecordSetsInput{
-		HostedZoneId: aws.String(b.ZoneID),
+		HostedZoneId: aws.String(z.id),
 		ChangeBatch: &route53.ChangeBatch{
 			Changes: myChanges,
 		},
 	}
 
-	if _, err := b.Svc.ChangeResourceRecordSets(changeInput); err != nil {
-		logrus.Errorf("Unable to delete recordSets from Route53. Error: %v", err)
+	out, err := b.Svc.ChangeResourceRecordSets(changeInput)
+	if err != nil {
+		logrus.Errorf("Unable to delete recordSets from Route53 zone %v. Error: %v", z.name, err)
+		return
 	}
+	b.emit(0, "", model.EventZoneRecordsPurged, model.WebhookRecordsData{Zone: z.name, Records: maps.Keys(recordsToDelete)})
+	b.audit(model.Actor{}, 0, "", model.AuditZonePurge, purgedRecords(recordsToDelete), nil, aws.StringValue(out.ChangeInfo.Id))
+
+	logrus.Infof("Records purged from Route53 zone %v: %v", z.name, len(recordsToDelete))
+}
 
-	logrus.Infof("Records purged from Route53: %v", len(recordsToDelete))
+// isPurgeableRecordType reports whether records of type rType can be created through the API and so are subject to
+// purging. Other types, such as the zone's NS and SOA records, are never touched.
+func isPurgeableRecordType(rType string) bool {
+	switch rType {
+	case model.RecordTypeA, model.RecordTypeAAAA, model.RecordTypeCname, model.RecordTypeTxt,
+		model.RecordTypeMx, model.RecordTypeSrv, model.RecordTypeCaa, model.RecordTypeAlias:
+		return true
+	}
+	return false
+}
+
+// purgedRecords describes the record sets purged from a zone as records, so that they can be recorded in the audit log
+func purgedRecords(recordSets map[model.FQDNTypePair]*route53.ResourceRecordSet) []db.Record {
+	records := make([]db.Record, 0, len(recordSets))
+	for pair, recordSet := range recordSets {
+		record := db.Record{
+			FQDN:          pair.FQDN,
+			Type:          pair.Type,
+			SetIdentifier: pair.SetIdentifier,
+			TTL:           aws.Int64Value(recordSet.TTL),
+		}
+		for _, rr := range recordSet.ResourceRecords {
+			record.Values = append(record.Values, db.RecordValue{Value: aws.StringValue(rr.Value)})
+		}
+		if recordSet.AliasTarget != nil {
+			record.Alias = model.AliasTarget{
+				HostedZoneID:         aws.StringValue(recordSet.AliasTarget.HostedZoneId),
+				DNSName:              aws.StringValue(recordSet.AliasTarget.DNSName),
+				EvaluateTargetHealth: aws.BoolValue(recordSet.AliasTarget.EvaluateTargetHealth),
+			}
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// emitPurged emits the events of the domains and records that were purged from the database and records them in the
+// audit log
+func (b *backend) emitPurged(domains []db.Domain, records []db.Record) {
+	domainNames := make(map[uint]string, len(domains))
+	for _, domain := range domains {
+		domainNames[domain.ID] = domain.Domain
+		b.emit(domain.ID, domain.Domain, model.EventDomainPurged, model.DomainResponse{Name: domain.Domain, Zone: domain.Zone})
+		b.audit(model.Actor{}, domain.ID, domain.Domain, model.AuditDomainPurge, nil, nil, "")
+	}
+
+	recordsByDomain := make(map[uint][]db.Record)
+	for _, record := range records {
+		recordsByDomain[record.DomainID] = append(recordsByDomain[record.DomainID], record)
+	}
+	for domainID, domainRecords := range recordsByDomain {
+		domainName, ok := domainNames[domainID]
+		if !ok {
+			domain, err := b.db.GetDomainByID(domainID)
+			if err != nil {
+				logrus.Errorf("Could not load domain %v from database. Error: %v", domainID, err)
+				continue
+			}
+			domainName = domain.Domain
+		}
+		b.emit(domainID, domainName, model.EventRecordsPurged, model.WebhookRecordsData{Records: recordPairs(domainRecords)})
+		b.audit(model.Actor{}, domainID, domainName, model.AuditRecordsPurge, domainRecords, nil, "")
+	}
+}
+
+// emitExpiring emits the events of the domains that will expire by the next purge unless they're renewed before then
+func (b *backend) emitExpiring() {
+	cutoff := time.Now().Add(time.Duration(b.purgeIntervalSeconds-b.domainMaxAgeSeconds) * time.Second)
+	domains, err := b.db.GetDomainsNotRenewedSince(cutoff)
+	if err != nil {
+		logrus.Errorf("Could not load expiring domains from database. Error: %v", err)
+		return
+	}
+	for _, domain := range domains {
+		if domain.SuspendedAt != nil {
+			continue
+		}
+		b.emit(domain.ID, domain.Domain, model.EventDomainExpiring, model.DomainResponse{Name: domain.Domain, Zone: domain.Zone})
+	}
 }
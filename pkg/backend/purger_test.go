@@ -0,0 +1,20 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestIsPurgeableRecordType(t *testing.T) {
+	// Every type records can be created with is purged, and nothing else is
+	for _, rType := range append(route53.RRType_Values(), model.RecordTypeAlias) {
+		t.Run(rType, func(t *testing.T) {
+			want := model.IsValidRecordType(rType) == nil
+			if got := isPurgeableRecordType(rType); got != want {
+				t.Errorf("isPurgeableRecordType(%v) = %v, want %v", rType, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+)
+
+const recordMutationsBucket = "record-mutations:domain:"
+
+// GetDomainQuota returns the domain's quota and how much of it is in use. The operator's overrides are only included if
+// withOverride is true.
+func (b *backend) GetDomainQuota(domain db.Domain, withOverride bool) (model.QuotaResponse, error) {
+	quota := b.domainQuota(domain)
+
+	records, err := b.db.CountDomainRecords(domain.ID)
+	if err != nil {
+		return model.QuotaResponse{}, err
+	}
+
+	resp := model.QuotaResponse{
+		Limits: quota,
+		Usage:  model.QuotaUsage{Records: records},
+	}
+	if quota.MaxMutationsPerMinute > 0 {
+		tokens, err := b.db.PeekRateLimitTokens(recordMutationsBucket+fmt.Sprint(domain.ID), mutationsRate(quota), float64(quota.MaxMutationsPerMinute))
+		if err != nil {
+			return model.QuotaResponse{}, err
+		}
+		resp.Usage.MutationsAvailable = int64(tokens)
+	}
+	if withOverride {
+		resp.Override = &model.DomainQuotaOverride{
+			MaxRecords:            domain.MaxRecords,
+			MaxValuesPerRecord:    domain.MaxValuesPerRecord,
+			MaxMutationsPerMinute: domain.MaxMutationsPerMinute,
+		}
+	}
+	return resp, nil
+}
+
+// SetDomainQuotaOverride replaces the operator's overrides of the server's default quota for the domain
+func (b *backend) SetDomainQuotaOverride(domainName string, override model.DomainQuotaOverride) (model.QuotaResponse, error) {
+	domain, err := b.db.GetDomain(domainName)
+	if err != nil {
+		return model.QuotaResponse{}, err
+	}
+	if domain.ID == 0 {
+		return model.QuotaResponse{}, fmt.Errorf("%w: domain %v", ErrNotFound, domainName)
+	}
+
+	if err := b.db.SetDomainQuotaOverride(domain.ID, override); err != nil {
+		return model.QuotaResponse{}, err
+	}
+
+	domain.MaxRecords = override.MaxRecords
+	domain.MaxValuesPerRecord = override.MaxValuesPerRecord
+	domain.MaxMutationsPerMinute = override.MaxMutationsPerMinute
+	return b.GetDomainQuota(domain, true)
+}
+
+// domainQuota returns the domain's quota, which is the server's default apart from what the operator overrode
+func (b *backend) domainQuota(domain db.Domain) model.DomainQuota {
+	quota := model.DomainQuota{
+		MaxRecords:            b.maxRecordsPerDomain,
+		MaxValuesPerRecord:    b.maxValuesPerRecord,
+		MaxMutationsPerMinute: b.maxRecordMutationsPerMinute,
+	}
+	if domain.MaxRecords != nil {
+		quota.MaxRecords = *domain.MaxRecords
+	}
+	if domain.MaxValuesPerRecord != nil {
+		quota.MaxValuesPerRecord = *domain.MaxValuesPerRecord
+	}
+	if domain.MaxMutationsPerMinute != nil {
+		quota.MaxMutationsPerMinute = *domain.MaxMutationsPerMinute
+	}
+	return quota
+}
+
+// loadDomainQuota returns the quota of the domain with the given name
+func (b *backend) loadDomainQuota(domainName string) (model.DomainQuota, error) {
+	domain, err := b.db.GetDomain(domainName)
+	if err != nil {
+		return model.DomainQuota{}, err
+	}
+	return b.domainQuota(domain), nil
+}
+
+// checkRecordsQuota fails if the domain would have more records than its quota allows once added records are created
+func (b *backend) checkRecordsQuota(quota model.DomainQuota, domainID uint, added int) error {
+	if quota.MaxRecords == 0 || added <= 0 {
+		return nil
+	}
+
+	records, err := b.db.CountDomainRecords(domainID)
+	if err != nil {
+		return err
+	}
+	if records+int64(added) > quota.MaxRecords {
+		return recordsQuotaError(quota)
+	}
+	return nil
+}
+
+// recordsLimit returns the most records the domain can have once a change that adds records to it is persisted. Only
+// changes that add records are held to it, so that a domain that has more records than a lowered quota allows can still
+// change them. checkRecordsQuota fails early for most changes that would exceed the quota, but only the database can
+// tell for concurrent changes.
+func recordsLimit(quota model.DomainQuota, added int) int64 {
+	if added <= 0 {
+		return 0
+	}
+	return quota.MaxRecords
+}
+
+func recordsQuotaError(quota model.DomainQuota) error {
+	return fmt.Errorf("%w: the domain can have at most %v records", ErrQuotaExceeded, quota.MaxRecords)
+}
+
+// checkValuesQuota fails if a record would have more values than the domain's quota allows
+func checkValuesQuota(quota model.DomainQuota, fqdn string, values int) error {
+	if quota.MaxValuesPerRecord > 0 && int64(values) > quota.MaxValuesPerRecord {
+		return fmt.Errorf("%w: %v can have at most %v values", ErrQuotaExceeded, fqdn, quota.MaxValuesPerRecord)
+	}
+	return nil
+}
+
+// takeMutation counts a change to the domain's records against its per minute limit, failing with a *RateLimitError if
+// the limit has been reached
+func (b *backend) takeMutation(quota model.DomainQuota, domainID uint) error {
+	if quota.MaxMutationsPerMinute == 0 {
+		return nil
+	}
+
+	allowed, retryAfter, err := b.db.TakeRateLimitToken(recordMutationsBucket+fmt.Sprint(domainID), mutationsRate(quota),
+		float64(quota.MaxMutationsPerMinute))
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return &RateLimitError{
+			Message:    fmt.Sprintf("the domain's records can be changed at most %v times per minute", quota.MaxMutationsPerMinute),
+			RetryAfter: retryAfter,
+		}
+	}
+	return nil
+}
+
+// mutationsRate returns the rate, in tokens per second, at which the domain's mutations bucket is refilled
+func mutationsRate(quota model.DomainQuota) float64 {
+	return float64(quota.MaxMutationsPerMinute) / 60
+}
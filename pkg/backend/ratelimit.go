@@ -0,0 +1,60 @@
+package backend
+
+import (
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	globalDomainCreationBucket = "create-domain"
+	ipDomainCreationBucket     = "create-domain:ip:"
+)
+
+// AllowDomainCreation applies the global and per-IP rate limits on creating domains to a request from ip. If either limit
+// is exceeded, it returns how long the client should wait before trying again.
+func (b *backend) AllowDomainCreation(ip string) (bool, time.Duration, error) {
+	if b.domainCreationIPRatePerHour > 0 && ip != "" {
+		allowed, retryAfter, err := b.db.TakeRateLimitToken(ipDomainCreationBucket+ip,
+			float64(b.domainCreationIPRatePerHour)/3600, float64(b.domainCreationIPBurst))
+		if err != nil || !allowed {
+			return false, retryAfter, err
+		}
+	}
+
+	if b.domainCreationGlobalRatePerHour > 0 {
+		return b.db.TakeRateLimitToken(globalDomainCreationBucket,
+			float64(b.domainCreationGlobalRatePerHour)/3600, float64(b.domainCreationGlobalBurst))
+	}
+
+	return true, 0, nil
+}
+
+func (b *backend) purgeRateLimitBuckets() {
+	// Once a bucket has been refilled completely, deleting it makes no difference, since a new bucket starts out full.
+	// The buckets of record mutations are refilled in a minute.
+	var maxAgeSeconds int64 = 60
+	if b.domainCreationIPRatePerHour > 0 {
+		if s := refillSeconds(b.domainCreationIPRatePerHour, b.domainCreationIPBurst); s > maxAgeSeconds {
+			maxAgeSeconds = s
+		}
+	}
+	if b.domainCreationGlobalRatePerHour > 0 {
+		if s := refillSeconds(b.domainCreationGlobalRatePerHour, b.domainCreationGlobalBurst); s > maxAgeSeconds {
+			maxAgeSeconds = s
+		}
+	}
+
+	deleted, err := b.db.PurgeOldRateLimitBuckets(maxAgeSeconds)
+	if err != nil {
+		logrus.Errorf("problem purging old rate limit buckets: %v", err)
+		return
+	}
+	logrus.Infof("Rate limit buckets purged from DB: %v", deleted)
+}
+
+// refillSeconds returns how long it takes an empty bucket to be refilled to burst tokens at ratePerHour
+func refillSeconds(ratePerHour, burst int64) int64 {
+	return int64(math.Ceil(float64(burst) * 3600 / float64(ratePerHour)))
+}
@@ -0,0 +1,221 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// valuesUpdateBackoff controls the retries of UpdateRecordValues when another writer changed the record concurrently
+var valuesUpdateBackoff = wait.Backoff{
+	Steps:    5,
+	Duration: 100 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.5,
+}
+
+// UpdateRecordValues adds values to and removes values from a record, leaving its other values in place. The record is
+// created if it doesn't exist yet and deleted if no values are left.
+//
+// Unlike CreateRecord, which UPSERTs, the change is made in Route53 by deleting the exact record set that was read and
+// creating the new one in the same change batch. Route53 rejects the batch if the record set changed in the meantime,
+// in which case the update is retried against the new values, so concurrent writers never lose each other's updates.
+// The precondition is checked against the record on every attempt, so a retry fails it if another writer changed the
+// record.
+func (b *backend) UpdateRecordValues(domain string, domainID uint, recordPrefix string, input model.RecordValuesRequest, precondition model.Precondition, actor model.Actor) (model.RecordResponse, error) {
+	fqdn := recordPrefix + domain
+
+	checkName, err := b.recordNameChecker()
+	if err != nil {
+		return model.RecordResponse{}, err
+	}
+	if err := checkName(recordPrefix); err != nil {
+		return model.RecordResponse{}, err
+	}
+
+	quota, err := b.loadDomainQuota(domain)
+	if err != nil {
+		return model.RecordResponse{}, err
+	}
+
+	z, err := b.domainZone(domainID)
+	if err != nil {
+		return model.RecordResponse{}, err
+	}
+
+	var (
+		result db.Record
+		taken  bool
+	)
+	err = wait.ExponentialBackoff(valuesUpdateBackoff, func() (bool, error) {
+		records, err := b.db.GetDomainRecordsByFQDN(fqdn, domainID)
+		if err != nil {
+			return false, err
+		}
+
+		var existing db.Record
+		for _, r := range records {
+			if r.Type == input.Type && r.SetIdentifier == input.SetIdentifier {
+				existing = r
+			}
+		}
+		if err := b.checkPrecondition(fqdn, input.Type, existing, precondition); err != nil {
+			return false, err
+		}
+
+		values := make([]db.RecordValue, 0, len(existing.Values)+len(input.Add))
+		for _, v := range existing.Values {
+			if !slices.Contains(input.Remove, v.Value) {
+				values = append(values, v)
+			}
+		}
+		for _, add := range input.Add {
+			if !slices.ContainsFunc(values, func(v db.RecordValue) bool { return v.Value == add }) {
+				values = append(values, db.RecordValue{Value: add})
+			}
+		}
+
+		if err := checkValuesQuota(quota, fqdn, len(values)); err != nil {
+			return false, err
+		}
+
+		record := existing
+		record.Values = values
+		if existing.ID == 0 {
+			if input.SetIdentifier != "" {
+				return false, fmt.Errorf("%w: %v has no %v record with set identifier %v", ErrNotFound, fqdn, input.Type, input.SetIdentifier)
+			}
+			if len(values) == 0 {
+				// Nothing to remove from and nothing to add
+				return true, nil
+			}
+
+			record = db.Record{
+				FQDN:     fqdn,
+				Type:     input.Type,
+				DomainID: domainID,
+				Values:   values,
+				TTL:      b.recordTTLSeconds,
+			}
+			if err := b.checkRecordsQuota(quota, domainID, 1); err != nil {
+				return false, err
+			}
+			for _, r := range records {
+				if err := recordConflict(r, record); err != nil {
+					return false, err
+				}
+			}
+		} else if record.HasValues(existing.ValueStrings()) {
+			// Nothing changed
+			result = existing
+			return true, nil
+		}
+
+		if input.Type == model.RecordTypeCname && len(values) > 1 {
+			return false, fmt.Errorf("%w: cname records must contain exactly one value", ErrInvalidRecord)
+		}
+
+		// The change only counts against the domain's mutations once it's known to be valid, and only once no matter how
+		// many times it's retried
+		if !taken {
+			if err := b.takeMutation(quota, domainID); err != nil {
+				return false, err
+			}
+			taken = true
+		}
+
+		var changes []*route53.Change
+		if existing.ID != 0 {
+			changes = append(changes, &route53.Change{
+				Action:            aws.String("DELETE"),
+				ResourceRecordSet: b.resourceRecordSet(existing),
+			})
+		}
+		if len(values) > 0 {
+			changes = append(changes, &route53.Change{
+				Action:            aws.String("CREATE"),
+				ResourceRecordSet: b.resourceRecordSet(record),
+			})
+		}
+
+		out, err := b.Svc.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(z.id),
+			ChangeBatch: &route53.ChangeBatch{
+				Changes: changes,
+			},
+		})
+		if isRecordSetMismatch(err) {
+			// The record set no longer matches what was read. Try again with a fresh read.
+			return false, nil
+		} else if isInvalidChangeBatch(err) {
+			return false, invalidChangeBatchError(err)
+		} else if err != nil {
+			return false, fmt.Errorf("failed to update route53 record %v with error %v", fqdn, err)
+		}
+
+		changeID := aws.StringValue(out.ChangeInfo.Id)
+
+		if len(values) == 0 {
+			if err := b.db.DeleteRecords([]db.Record{existing}); err != nil {
+				return false, err
+			}
+			if err := b.deleteRecordsHealthChecks([]db.Record{existing}); err != nil {
+				logrus.Errorf("Unable to delete health checks of deleted record %v %v. Error: %v", existing.FQDN, existing.Type, err)
+			}
+			b.audit(actor, domainID, domain, model.AuditRecordDelete, []db.Record{existing}, nil, changeID)
+			b.emitRecordChanges(domainID, domain, []db.Record{existing}, nil)
+			return true, nil
+		}
+
+		var added int
+		if existing.ID == 0 {
+			added = 1
+		}
+		result, err = b.db.PersistRecord(record, recordsLimit(quota, added))
+		if errors.Is(err, db.ErrTooManyRecords) {
+			b.undoChanges(z, []*route53.Change{{
+				Action:            aws.String("DELETE"),
+				ResourceRecordSet: b.resourceRecordSet(record),
+			}})
+			return false, recordsQuotaError(quota)
+		} else if err != nil {
+			return false, err
+		}
+		if existing.ID == 0 {
+			b.audit(actor, domainID, domain, model.AuditRecordCreate, nil, []db.Record{result}, changeID)
+		} else {
+			b.audit(actor, domainID, domain, model.AuditRecordUpdate, []db.Record{existing}, []db.Record{result}, changeID)
+		}
+		b.emitRecordChanges(domainID, domain, nil, []db.Record{result})
+		return true, nil
+	})
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		return model.RecordResponse{}, fmt.Errorf("%w: %v is being changed concurrently, try again", ErrConflict, fqdn)
+	} else if err != nil {
+		return model.RecordResponse{}, err
+	}
+
+	resp := model.RecordResponse{
+		RecordRequest: model.RecordRequest{
+			Name:          recordPrefix,
+			Type:          input.Type,
+			Values:        result.ValueStrings(),
+			TTL:           result.TTL,
+			RoutingPolicy: result.Routing(),
+		},
+		FQDN: fqdn,
+	}
+	// A record that was deleted, or never created, has no revision
+	if result.ID != 0 {
+		resp.ETag = model.ETag(result.Revision)
+	}
+	return resp, nil
+}
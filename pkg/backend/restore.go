@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/sirupsen/logrus"
+)
+
+// RestoreDomain undeletes a purged domain, which makes its token valid again, as long as it was purged within the
+// retention period. The domain is renewed and whichever of its records haven't been purged yet are put back in its zone.
+// Its webhook subscriptions were deleted along with it, so they have to be created again.
+func (b *backend) RestoreDomain(domainName string, actor model.Actor) (model.DomainResponse, error) {
+	domain, err := b.db.GetDeletedDomain(domainName)
+	if err != nil {
+		return model.DomainResponse{}, err
+	}
+	if domain.ID == 0 {
+		return model.DomainResponse{}, fmt.Errorf("%w: no deleted domain %v", ErrNotFound, domainName)
+	}
+	if time.Since(domain.DeletedAt.Time) > time.Duration(b.deletedDomainRetentionSeconds)*time.Second {
+		return model.DomainResponse{}, fmt.Errorf("%w: domain %v was deleted too long ago to be restored", ErrNotFound, domainName)
+	}
+
+	if err := b.db.RestoreDomain(domain.ID); errors.Is(err, db.ErrDomainTaken) {
+		return model.DomainResponse{}, fmt.Errorf("%w: domain %v can't be restored: %v", ErrConflict, domainName, err)
+	} else if err != nil {
+		return model.DomainResponse{}, err
+	}
+
+	// The domain's own hosted zone is torn down once it's deleted, so it gets a new one
+	if b.subZones && domain.SubZoneID == "" {
+		z, err := b.servedZone(domain.Zone)
+		if err != nil {
+			return model.DomainResponse{}, err
+		}
+		if !z.customDomains {
+			if err := b.createSubZone(domain, z); err != nil {
+				return model.DomainResponse{}, err
+			}
+		}
+	}
+
+	if domain.SuspendedAt != nil {
+		if err := b.resumeDomain(domain, actor); err != nil {
+			return model.DomainResponse{}, err
+		}
+	}
+
+	logrus.Infof("Domain %v restored", domain.Domain)
+	resp := model.DomainResponse{Name: domain.Domain, Zone: domain.Zone}
+	b.emit(domain.ID, domain.Domain, model.EventDomainRestored, resp)
+	b.audit(actor, domain.ID, domain.Domain, model.AuditDomainRestore, nil, nil, "")
+	return resp, nil
+}
+
+// purgeDeletedDomains permanently deletes the domains that can no longer be restored
+func (b *backend) purgeDeletedDomains() {
+	deleted, err := b.db.PurgeDeletedDomains(b.deletedDomainRetentionSeconds)
+	if err != nil {
+		logrus.Errorf("problem purging deleted domains: %v", err)
+		return
+	}
+	for _, domain := range deleted {
+		b.audit(model.Actor{}, domain.ID, domain.Domain, model.AuditDomainErase, nil, nil, "")
+	}
+	logrus.Infof("Deleted domains purged from DB: %v", len(deleted))
+}
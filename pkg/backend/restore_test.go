@@ -0,0 +1,66 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/acorn-io/acorn-dns/pkg/model"
+)
+
+func TestRestoreDomain(t *testing.T) {
+	tests := []struct {
+		name             string
+		retentionSeconds int64
+		purge            bool
+		wantErr          error
+		wantSlugTaken    bool
+	}{
+		{name: "within retention", retentionSeconds: 3600, wantSlugTaken: true},
+		{name: "within retention after purging", retentionSeconds: 3600, purge: true, wantSlugTaken: true},
+		{name: "after retention", retentionSeconds: 0, wantErr: ErrNotFound, wantSlugTaken: true},
+		{name: "after retention and purging", retentionSeconds: 0, purge: true, wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBackend(t)
+			b.deletedDomainRetentionSeconds = tt.retentionSeconds
+
+			domain, err := b.db.CreateSubDomainWithSlug("hash", "example.com", "abc123", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := b.db.DeleteDomain(domain.ID); err != nil {
+				t.Fatal(err)
+			}
+			if tt.purge {
+				b.purgeDeletedDomains()
+			}
+
+			_, err = b.RestoreDomain(domain.Domain, model.Actor{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RestoreDomain() error = %v, want %v", err, tt.wantErr)
+			}
+			restored, err := b.db.GetDomain(domain.Domain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wantRestored := tt.wantErr == nil; (restored.ID != 0) != wantRestored {
+				t.Errorf("domain restored = %v, want %v", restored.ID != 0, wantRestored)
+			}
+
+			// Once the domain is deleted for good, its slug can be given to another domain
+			taken, err := b.db.IsSlugTaken(domain.UniqueSlug)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if taken != tt.wantSlugTaken {
+				t.Errorf("slug taken = %v, want %v", taken, tt.wantSlugTaken)
+			}
+			if !taken {
+				if _, err := b.db.CreateSubDomainWithSlug("other", "example.com", domain.UniqueSlug, ""); err != nil {
+					t.Errorf("creating a domain with the freed slug failed: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -1,11 +1,15 @@
 package backend
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"strings"
 
 	"github.com/acorn-io/acorn-dns/pkg/db"
 	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/acorn-io/acorn-dns/pkg/policy"
 	"github.com/acorn-io/acorn-dns/pkg/rand"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -19,19 +23,110 @@ const (
 	tokenLength = 32
 )
 
+// Config holds the settings a backend is created with
+type Config struct {
+	// ZoneID is the default zone, which domains are created in unless another one is requested
+	ZoneID string
+	// AdditionalZoneIDs are the other zones domains can be created in
+	AdditionalZoneIDs           []string
+	RecordTTLSeconds            int64
+	RecordMinTTLSeconds         int64
+	RecordMaxTTLSeconds         int64
+	PurgeIntervalSeconds        int64
+	DomainMaxAgeSeconds         int64
+	RecordMaxAgeSeconds         int64
+	ACMEChallengeMaxAgeSeconds  int64
+	IdempotencyKeyMaxAgeSeconds int64
+	// DomainGracePeriodSeconds is how long an expired domain can still be reclaimed by renewing it before it's purged.
+	// Records that were purged before it expired aren't restored by reclaiming it.
+	DomainGracePeriodSeconds int64
+	// DeletedDomainRetentionSeconds is how long a purged domain can be restored before it's deleted for good, which
+	// frees its slug
+	DeletedDomainRetentionSeconds int64
+	// AuditLogMaxAgeSeconds is how long entries are kept in the audit log
+	AuditLogMaxAgeSeconds int64
+	// The domain creation rate limits are disabled when their rate is 0
+	DomainCreationIPRatePerHour     int64
+	DomainCreationIPBurst           int64
+	DomainCreationGlobalRatePerHour int64
+	DomainCreationGlobalBurst       int64
+	// The default quotas of domains, which are unlimited when 0
+	MaxRecordsPerDomain         int64
+	MaxValuesPerRecord          int64
+	MaxRecordMutationsPerMinute int64
+	// NameRules deny slugs and record labels, in addition to the rules operators manage through the admin API
+	NameRules []model.NameRule
+	// VanitySlugs lets anyone request a slug. Otherwise, requesting one requires an invitation code.
+	VanitySlugs bool
+	// SubZones gives each new domain its own hosted zone, delegated from the zone it's created in
+	SubZones bool
+	// CustomDomainZoneIDs are the zones that hold custom domains, which users create under names they own
+	CustomDomainZoneIDs []string
+	// VerificationResolver is the address of the DNS server custom domains' challenges are looked up with. The system's
+	// resolver is used when it's empty.
+	VerificationResolver                  string
+	CustomDomainVerificationMaxAgeSeconds int64
+	// DNSSECKMSKeyARN is the KMS key the key-signing keys of zones are created with. Zones can't be signed without it.
+	DNSSECKMSKeyARN string
+	// WebhookAllowPrivateAddresses lets webhooks be delivered to loopback, private and link-local addresses
+	WebhookAllowPrivateAddresses bool
+}
+
 type backend struct {
-	baseDomain           string
-	ZoneID               string
-	recordTTLSeconds     int64
-	purgeIntervalSeconds int64
-	domainMaxAgeSeconds  int64
-	recordMaxAgeSeconds  int64
+	// zones are the zones domains can be created in, starting with the default one and ending with the ones that hold
+	// custom domains
+	zones                       []zone
+	resolver                    *net.Resolver
+	subZones                    bool
+	dnssecKMSKeyARN             string
+	webhookClient               *http.Client
+	recordTTLSeconds            int64
+	recordMinTTLSeconds         int64
+	recordMaxTTLSeconds         int64
+	purgeIntervalSeconds        int64
+	domainMaxAgeSeconds         int64
+	recordMaxAgeSeconds         int64
+	acmeChallengeMaxAgeSeconds  int64
+	idempotencyKeyMaxAgeSeconds int64
+	domainGracePeriodSeconds    int64
+
+	deletedDomainRetentionSeconds int64
+	auditLogMaxAgeSeconds         int64
+
+	customDomainVerificationMaxAgeSeconds int64
+
+	domainCreationIPRatePerHour     int64
+	domainCreationIPBurst           int64
+	domainCreationGlobalRatePerHour int64
+	domainCreationGlobalBurst       int64
+
+	maxRecordsPerDomain         int64
+	maxValuesPerRecord          int64
+	maxRecordMutationsPerMinute int64
+
+	policy      *policy.Policy
+	vanitySlugs bool
 
 	Svc *route53.Route53
 	db  db.Database
 }
 
-func NewBackend(zoneID string, recordTTLSecs, purgeIntervalSecs, domainMaxAgeSecs, recordMaxAgeSecs int64, database db.Database) (Backend, error) {
+func NewBackend(cfg Config, database db.Database) (Backend, error) {
+	if cfg.RecordTTLSeconds < cfg.RecordMinTTLSeconds || cfg.RecordTTLSeconds > cfg.RecordMaxTTLSeconds {
+		return &backend{}, fmt.Errorf("default record TTL %v is outside of the allowed range %v-%v",
+			cfg.RecordTTLSeconds, cfg.RecordMinTTLSeconds, cfg.RecordMaxTTLSeconds)
+	}
+
+	if cfg.DomainCreationIPRatePerHour > 0 && cfg.DomainCreationIPBurst < 1 ||
+		cfg.DomainCreationGlobalRatePerHour > 0 && cfg.DomainCreationGlobalBurst < 1 {
+		return &backend{}, fmt.Errorf("domain creation rate limit bursts must be at least 1")
+	}
+
+	namePolicy, err := policy.New(cfg.NameRules)
+	if err != nil {
+		return &backend{}, err
+	}
+
 	s, err := session.NewSession()
 	if err != nil {
 		return &backend{}, err
@@ -41,22 +136,45 @@ func NewBackend(zoneID string, recordTTLSecs, purgeIntervalSecs, domainMaxAgeSec
 		MaxRetries: aws.Int(3),
 	})
 
-	z, err := svc.GetHostedZone(&route53.GetHostedZoneInput{
-		Id: aws.String(zoneID),
-	})
+	zones, err := loadZones(svc, append([]string{cfg.ZoneID}, cfg.AdditionalZoneIDs...), cfg.CustomDomainZoneIDs)
 	if err != nil {
 		return &backend{}, err
 	}
 
 	return &backend{
-		db:                   database,
-		baseDomain:           strings.TrimSuffix(aws.StringValue(z.HostedZone.Name), "."),
-		ZoneID:               aws.StringValue(z.HostedZone.Id),
-		Svc:                  svc,
-		recordTTLSeconds:     recordTTLSecs,
-		purgeIntervalSeconds: purgeIntervalSecs,
-		domainMaxAgeSeconds:  domainMaxAgeSecs,
-		recordMaxAgeSeconds:  recordMaxAgeSecs,
+		db:                          database,
+		zones:                       zones,
+		resolver:                    newResolver(cfg.VerificationResolver),
+		subZones:                    cfg.SubZones,
+		dnssecKMSKeyARN:             cfg.DNSSECKMSKeyARN,
+		webhookClient:               newWebhookClient(cfg.WebhookAllowPrivateAddresses),
+		Svc:                         svc,
+		recordTTLSeconds:            cfg.RecordTTLSeconds,
+		recordMinTTLSeconds:         cfg.RecordMinTTLSeconds,
+		recordMaxTTLSeconds:         cfg.RecordMaxTTLSeconds,
+		purgeIntervalSeconds:        cfg.PurgeIntervalSeconds,
+		domainMaxAgeSeconds:         cfg.DomainMaxAgeSeconds,
+		recordMaxAgeSeconds:         cfg.RecordMaxAgeSeconds,
+		acmeChallengeMaxAgeSeconds:  cfg.ACMEChallengeMaxAgeSeconds,
+		idempotencyKeyMaxAgeSeconds: cfg.IdempotencyKeyMaxAgeSeconds,
+		domainGracePeriodSeconds:    cfg.DomainGracePeriodSeconds,
+
+		deletedDomainRetentionSeconds: cfg.DeletedDomainRetentionSeconds,
+		auditLogMaxAgeSeconds:         cfg.AuditLogMaxAgeSeconds,
+
+		customDomainVerificationMaxAgeSeconds: cfg.CustomDomainVerificationMaxAgeSeconds,
+
+		domainCreationIPRatePerHour:     cfg.DomainCreationIPRatePerHour,
+		domainCreationIPBurst:           cfg.DomainCreationIPBurst,
+		domainCreationGlobalRatePerHour: cfg.DomainCreationGlobalRatePerHour,
+		domainCreationGlobalBurst:       cfg.DomainCreationGlobalBurst,
+
+		maxRecordsPerDomain:         cfg.MaxRecordsPerDomain,
+		maxValuesPerRecord:          cfg.MaxValuesPerRecord,
+		maxRecordMutationsPerMinute: cfg.MaxRecordMutationsPerMinute,
+
+		policy:      namePolicy,
+		vanitySlugs: cfg.VanitySlugs,
 	}, nil
 }
 
@@ -65,7 +183,7 @@ func (b *backend) GetDomain(domainName string) (db.Domain, error) {
 	return b.db.GetDomain(domainName)
 }
 
-func (b *backend) Renew(domain string, domainID uint, records []model.RecordRequest, version string) ([]model.FQDNTypePair, error) {
+func (b *backend) Renew(domain string, domainID uint, records []model.RecordRequest, version string, actor model.Actor) ([]model.FQDNTypePair, error) {
 	recordMap := make(map[model.FQDNTypePair]model.RecordRequest)
 	var cleanedRecords []model.FQDNTypePair
 	// remove duplicates and FQDNs that don't belong to this domain
@@ -80,13 +198,14 @@ func (b *backend) Renew(domain string, domainID uint, records []model.RecordRequ
 			} else {
 				fqdn = record.Name + "." + domain
 			}
-		} else if strings.HasSuffix(record.Name, b.baseDomain) {
+		} else if b.isZoneName(record.Name) {
 			// Record is an FQDN, but doesn't match the validated domain. Error out.
 			return nil, fmt.Errorf("invalid record %v doesn't match %v", record.Name, domain)
 		}
 		pair := model.FQDNTypePair{
-			FQDN: fqdn,
-			Type: record.Type,
+			FQDN:          fqdn,
+			Type:          record.Type,
+			SetIdentifier: record.SetIdentifier(),
 		}
 		if _, ok := recordMap[pair]; !ok {
 			cleanedRecords = append(cleanedRecords, pair)
@@ -94,9 +213,23 @@ func (b *backend) Renew(domain string, domainID uint, records []model.RecordRequ
 		recordMap[pair] = record
 	}
 
+	// Renewing a domain in its grace period reclaims its name and token. Only the records that haven't been purged yet
+	// are restored. The rest are reported as out of sync, for the client to create again.
+	domainRow, err := b.db.GetDomainByID(domainID)
+	if err != nil {
+		return nil, err
+	}
+	if domainRow.SuspendedAt != nil {
+		if err := b.resumeDomain(domainRow, actor); err != nil {
+			return nil, err
+		}
+		logrus.Infof("Domain %v reclaimed from its grace period", domain)
+	}
+
 	if err := b.db.Renew(domainID, cleanedRecords, version); err != nil {
 		return nil, err
 	}
+	b.audit(actor, domainID, domain, model.AuditDomainRenew, nil, nil, "")
 
 	domainRecords, err := b.db.GetDomainRecords(domainID)
 	if err != nil {
@@ -106,37 +239,93 @@ func (b *backend) Renew(domain string, domainID uint, records []model.RecordRequ
 	var outOfSync []model.FQDNTypePair
 	for pair, record := range recordMap {
 		if dr, ok := domainRecords[pair]; ok {
-			if dr.Values != db.DenormalizeValues(record.Values) {
+			if !b.inSync(dr, record) {
 				// The renew request should return the "short" name part of the FQDN, not the entire FQDN
-				outOfSync = append(outOfSync, model.FQDNTypePair{FQDN: record.Name, Type: record.Type})
+				outOfSync = append(outOfSync, model.FQDNTypePair{FQDN: record.Name, Type: record.Type, SetIdentifier: pair.SetIdentifier})
 			}
 		} else {
-			outOfSync = append(outOfSync, model.FQDNTypePair{FQDN: record.Name, Type: record.Type})
+			outOfSync = append(outOfSync, model.FQDNTypePair{FQDN: record.Name, Type: record.Type, SetIdentifier: pair.SetIdentifier})
 		}
 	}
 
 	return outOfSync, nil
 }
 
-func (b *backend) CreateDomain() (model.DomainResponse, error) {
+// CreateDomain creates a domain in the named zone, or the default zone if zoneName is empty, with a random slug or, if
+// one is given, the requested slug. Requesting a slug requires vanity slugs to be enabled or an invitation code.
+func (b *backend) CreateDomain(zoneName, slug, invitationCode string, neverExpires bool, actor model.Actor) (model.DomainResponse, error) {
 	logrus.Debugf("Creating a new domain")
+
+	z, err := b.zoneByName(zoneName)
+	if err != nil {
+		return model.DomainResponse{}, err
+	}
+
+	var invitationCodeHash string
+	if slug != "" {
+		invitationCodeHash, err = b.vanitySlugAccess(invitationCode)
+		if err != nil {
+			return model.DomainResponse{}, err
+		}
+	}
+
+	rules, err := b.operatorRules()
+	if err != nil {
+		return model.DomainResponse{}, err
+	}
+	if slug != "" {
+		if err := b.checkVanitySlug(slug, rules); err != nil {
+			return model.DomainResponse{}, err
+		}
+	}
+
 	token, hash, err := b.createToken()
 	if err != nil {
 		return model.DomainResponse{}, err
 	}
 
-	domain, err := b.db.CreateNewSubDomain(hash, b.baseDomain)
+	var domain db.Domain
+	if slug != "" {
+		domain, err = b.db.CreateSubDomainWithSlug(hash, z.name, slug, invitationCodeHash)
+		if errors.Is(err, db.ErrSlugTaken) {
+			return model.DomainResponse{}, fmt.Errorf("%w: slug %v is taken", ErrConflict, slug)
+		} else if errors.Is(err, db.ErrInvalidInvitation) {
+			return model.DomainResponse{}, fmt.Errorf("%w: %v", ErrForbidden, err)
+		}
+	} else {
+		allowSlug := func(slug string) bool {
+			return b.policy.CheckSlug(slug, rules) == nil
+		}
+		domain, err = b.db.CreateNewSubDomain(hash, z.name, neverExpires, allowSlug)
+	}
 	if err != nil {
 		return model.DomainResponse{}, err
 	}
 
+	if b.subZones {
+		if err := b.createSubZone(domain, z); err != nil {
+			// The domain is deleted so that it can't be used without its zone. Whatever was created of the zone is
+			// torn down by the purger.
+			if err := b.db.DeleteDomain(domain.ID); err != nil {
+				logrus.Errorf("Unable to delete domain %v after failing to create its hosted zone. Error: %v", domain.Domain, err)
+			}
+			return model.DomainResponse{}, err
+		}
+	}
+
+	b.emit(domain.ID, domain.Domain, model.EventDomainCreated, model.DomainResponse{Name: domain.Domain, Zone: domain.Zone})
+	// The domain is created without authenticating, so it's attributed to the token it's created with
+	actor.TokenID = model.TokenID(token)
+	b.audit(actor, domain.ID, domain.Domain, model.AuditDomainCreate, nil, nil, "")
+
 	return model.DomainResponse{
 		Name:  domain.Domain,
+		Zone:  domain.Zone,
 		Token: token,
 	}, nil
 }
 
-func (b *backend) DeleteRecord(recordPrefix string, domain string, domainID uint) error {
+func (b *backend) DeleteRecord(recordPrefix string, domain string, domainID uint, rType string, setIdentifier string, precondition model.Precondition, actor model.Actor) error {
 	fqdn := recordPrefix + domain
 
 	records, err := b.db.GetDomainRecordsByFQDN(fqdn, domainID)
@@ -144,109 +333,470 @@ func (b *backend) DeleteRecord(recordPrefix string, domain string, domainID uint
 		return err
 	}
 
-	if err = b.doRecordsDelete(records); err != nil {
+	// Without a type or set identifier, every record at the FQDN is deleted
+	if rType != "" || setIdentifier != "" {
+		var matching []db.Record
+		for _, r := range records {
+			if (rType == "" || r.Type == rType) && (setIdentifier == "" || r.SetIdentifier == setIdentifier) {
+				matching = append(matching, r)
+			}
+		}
+		records = matching
+	}
+
+	// Every record that is deleted must meet the precondition
+	if precondition != (model.Precondition{}) {
+		if len(records) == 0 && !precondition.Met("") {
+			return fmt.Errorf("%w: %v has no matching records", ErrPreconditionFailed, fqdn)
+		}
+		for _, r := range records {
+			if err := b.checkPrecondition(r.FQDN, r.Type, r, precondition); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Deleting nothing doesn't count against the domain's mutations
+	if len(records) > 0 {
+		quota, err := b.loadDomainQuota(domain)
+		if err != nil {
+			return err
+		}
+		if err := b.takeMutation(quota, domainID); err != nil {
+			return err
+		}
+	}
+
+	changeID, err := b.doRecordsDelete(domainID, records)
+	if precondition != (model.Precondition{}) && isRecordSetMismatch(err) {
+		// Route53 only deletes the exact record sets that were read, so one of them was changed concurrently
+		return fmt.Errorf("%w: %v is being changed concurrently", ErrPreconditionFailed, fqdn)
+	} else if isInvalidChangeBatch(err) {
+		return invalidChangeBatchError(err)
+	} else if err != nil {
 		return fmt.Errorf("failed to delete route53 records for FQDN %v with error %v", fqdn, err)
 	}
+	if len(records) > 0 {
+		b.emit(domainID, domain, model.EventRecordDeleted, model.WebhookRecordsData{Records: recordPairs(records)})
+		b.audit(actor, domainID, domain, model.AuditRecordDelete, records, nil, changeID)
+	}
 	return nil
 }
 
-func (b *backend) PurgeRecords(domain string, domainID uint) error {
+func (b *backend) PurgeRecords(domain string, domainID uint, actor model.Actor) error {
 	recs, err := b.db.GetDomainRecords(domainID)
 	if err != nil {
 		return err
 	}
 	records := maps.Values(recs)
-	if err = b.doRecordsDelete(records); err != nil {
+	changeID, err := b.doRecordsDelete(domainID, records)
+	if err != nil {
 		return fmt.Errorf("failed to delete route53 records for domain %v with error %v", domain, err)
 	}
+	if len(records) > 0 {
+		b.emit(domainID, domain, model.EventRecordsPurged, model.WebhookRecordsData{Records: recordPairs(records)})
+		b.audit(actor, domainID, domain, model.AuditRecordsPurge, records, nil, changeID)
+	}
 	return nil
 }
 
-func (b *backend) doRecordsDelete(records []db.Record) error {
+// undoChanges reverts changes that were made in Route53 but couldn't be persisted, by applying the given changes that
+// undo them. Failing to undo them is only logged, since the purger deletes record sets that aren't in the database
+// anyway.
+func (b *backend) undoChanges(z zone, undo []*route53.Change) {
+	_, err := b.Svc.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(z.id),
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: undo,
+		},
+	})
+	if err != nil {
+		logrus.Errorf("Unable to undo changes to route53 zone %v that couldn't be persisted. Error: %v", z.name, err)
+	}
+}
+
+// doRecordsDelete deletes records of the domain with the given ID and returns the ID of the Route53 change
+func (b *backend) doRecordsDelete(domainID uint, records []db.Record) (string, error) {
 	if len(records) == 0 {
-		return nil
+		return "", nil
+	}
+
+	z, err := b.domainZone(domainID)
+	if err != nil {
+		return "", err
 	}
 
 	changes := make([]*route53.Change, 0)
 	for _, record := range records {
-		rrs := &route53.ResourceRecordSet{
-			Type: aws.String(record.Type),
-			Name: aws.String(record.FQDN),
-			TTL:  aws.Int64(b.recordTTLSeconds),
-		}
-		rr := make([]*route53.ResourceRecord, 0)
-		for _, value := range strings.Split(record.Values, ",") {
-			rr = append(rr, &route53.ResourceRecord{
-				Value: aws.String(cleanRecordValue(record.Type, value)),
-			})
-		}
-		rrs.ResourceRecords = rr
 		changes = append(changes, &route53.Change{
 			Action:            aws.String("DELETE"),
-			ResourceRecordSet: rrs,
+			ResourceRecordSet: b.resourceRecordSet(record),
 		})
 	}
 
 	rrsInput := route53.ChangeResourceRecordSetsInput{
-		HostedZoneId: aws.String(b.ZoneID),
+		HostedZoneId: aws.String(z.id),
 		ChangeBatch: &route53.ChangeBatch{
 			Changes: changes,
 		},
 	}
 
-	if _, err := b.Svc.ChangeResourceRecordSets(&rrsInput); err != nil {
-		return err
+	out, err := b.Svc.ChangeResourceRecordSets(&rrsInput)
+	if err != nil {
+		return "", err
 	}
 
-	return b.db.DeleteRecords(records)
+	// The records are deleted from the database right away, so that it matches the zone even if deleting their health
+	// checks fails. The health checks go once the record sets that may reference them are gone.
+	if err := b.db.DeleteRecords(records); err != nil {
+		return "", err
+	}
+	if err := b.deleteRecordsHealthChecks(records); err != nil {
+		logrus.Errorf("Unable to delete health checks of deleted records. Error: %v", err)
+	}
+
+	return aws.StringValue(out.ChangeInfo.Id), nil
 }
 
-func (b *backend) CreateRecord(domain string, domainID uint, input model.RecordRequest) (model.RecordResponse, error) {
-	rr := make([]*route53.ResourceRecord, 0)
+// GetRecord returns the record of the given type and set identifier, along with the ETag that preconditions on it are
+// checked against
+func (b *backend) GetRecord(recordPrefix string, domain string, domainID uint, rType string, setIdentifier string) (model.RecordResponse, error) {
+	fqdn := recordPrefix + domain
 
-	for _, value := range input.Values {
-		rr = append(rr, &route53.ResourceRecord{
-			Value: aws.String(cleanRecordValue(input.Type, value)),
-		})
+	records, err := b.db.GetDomainRecordsByFQDN(fqdn, domainID)
+	if err != nil {
+		return model.RecordResponse{}, err
+	}
+	for _, r := range records {
+		if r.Type != rType || r.SetIdentifier != setIdentifier {
+			continue
+		}
+		resp := recordResponse(r)
+		resp.Name = recordPrefix
+		resp.ETag = model.ETag(r.Revision)
+		return resp, nil
 	}
+	return model.RecordResponse{}, fmt.Errorf("%w: %v has no %v record", ErrNotFound, fqdn, rType)
+}
 
+func (b *backend) CreateRecord(domain string, domainID uint, input model.RecordRequest, precondition model.Precondition, actor model.Actor) (model.RecordResponse, error) {
 	fqdn := input.Name + domain
-	rrs := &route53.ResourceRecordSet{
-		Type:            aws.String(input.Type),
-		Name:            aws.String(fqdn),
-		ResourceRecords: rr,
-		TTL:             aws.Int64(b.recordTTLSeconds),
+
+	checkName, err := b.recordNameChecker()
+	if err != nil {
+		return model.RecordResponse{}, err
+	}
+	if err := checkName(input.Name); err != nil {
+		return model.RecordResponse{}, err
+	}
+
+	existing, err := b.db.GetDomainRecordsByFQDN(fqdn, domainID)
+	if err != nil {
+		return model.RecordResponse{}, err
+	}
+
+	record, err := b.newRecord(fqdn, domainID, &input, existing)
+	if err != nil {
+		return model.RecordResponse{}, err
+	}
+
+	var current db.Record
+	for _, r := range existing {
+		if r.Pair() == record.Pair() {
+			current = r
+		}
+	}
+
+	quota, err := b.loadDomainQuota(domain)
+	if err != nil {
+		return model.RecordResponse{}, err
+	}
+	if err := checkValuesQuota(quota, fqdn, len(record.Values)); err != nil {
+		return model.RecordResponse{}, err
+	}
+	if current.ID == 0 {
+		if err := b.checkRecordsQuota(quota, domainID, 1); err != nil {
+			return model.RecordResponse{}, err
+		}
+	}
+	if err := b.checkPrecondition(fqdn, record.Type, current, precondition); err != nil {
+		return model.RecordResponse{}, err
+	}
+	if err := b.takeMutation(quota, domainID); err != nil {
+		return model.RecordResponse{}, err
+	}
+
+	z, err := b.domainZone(domainID)
+	if err != nil {
+		return model.RecordResponse{}, err
+	}
+
+	// A conditional request replaces the exact record set its precondition was checked against, like UpdateRecordValues
+	// does, so that Route53 rejects the change if the record set was changed concurrently
+	conditional := precondition != (model.Precondition{})
+	changes := []*route53.Change{
+		{
+			Action:            aws.String("UPSERT"),
+			ResourceRecordSet: b.resourceRecordSet(record),
+		},
+	}
+	if conditional {
+		changes[0].Action = aws.String("CREATE")
+		if current.ID != 0 {
+			changes = append([]*route53.Change{{
+				Action:            aws.String("DELETE"),
+				ResourceRecordSet: b.resourceRecordSet(current),
+			}}, changes...)
+		}
 	}
 
 	rrsInput := route53.ChangeResourceRecordSetsInput{
-		HostedZoneId: aws.String(b.ZoneID),
+		HostedZoneId: aws.String(z.id),
 		ChangeBatch: &route53.ChangeBatch{
-			Changes: []*route53.Change{
-				{
-					Action:            aws.String("UPSERT"),
-					ResourceRecordSet: rrs,
-				},
-			},
+			Changes: changes,
 		},
 	}
 
-	if _, err := b.Svc.ChangeResourceRecordSets(&rrsInput); err != nil {
+	out, err := b.Svc.ChangeResourceRecordSets(&rrsInput)
+	if conditional && isRecordSetMismatch(err) {
+		return model.RecordResponse{}, fmt.Errorf("%w: %v record %v is being changed concurrently", ErrPreconditionFailed, record.Type, fqdn)
+	} else if isInvalidChangeBatch(err) {
+		return model.RecordResponse{}, invalidChangeBatchError(err)
+	} else if err != nil {
 		return model.RecordResponse{}, fmt.Errorf("failed to upsert route53 record %v with error %v", fqdn, err)
 	}
 
-	if err := b.db.PersistRecord(domainID, fqdn, input.Type, input.Values); err != nil {
+	var added int
+	if current.ID == 0 {
+		added = 1
+	}
+	if conditional {
+		// The revision the precondition was checked against is claimed along with persisting the record
+		record, err = b.db.PersistRecordIfUnchanged(record, current, recordsLimit(quota, added))
+		if errors.Is(err, db.ErrRevisionChanged) {
+			return model.RecordResponse{}, fmt.Errorf("%w: %v record %v is being changed concurrently", ErrPreconditionFailed, record.Type, fqdn)
+		}
+	} else {
+		record, err = b.db.PersistRecord(record, recordsLimit(quota, added))
+	}
+	if errors.Is(err, db.ErrTooManyRecords) {
+		// Only a record that didn't exist is held to the limit, so undoing the change is deleting it
+		b.undoChanges(z, []*route53.Change{{
+			Action:            aws.String("DELETE"),
+			ResourceRecordSet: changes[len(changes)-1].ResourceRecordSet,
+		}})
+		return model.RecordResponse{}, recordsQuotaError(quota)
+	} else if err != nil {
 		return model.RecordResponse{}, err
 	}
 
-	return model.RecordResponse{
+	resp := model.RecordResponse{
 		RecordRequest: input,
 		FQDN:          fqdn,
-	}, nil
+		ETag:          model.ETag(record.Revision),
+	}
+	b.emit(domainID, domain, model.EventRecordCreated, resp)
+	if current.ID == 0 {
+		b.audit(actor, domainID, domain, model.AuditRecordCreate, nil, []db.Record{record}, aws.StringValue(out.ChangeInfo.Id))
+	} else {
+		b.audit(actor, domainID, domain, model.AuditRecordUpdate, []db.Record{current}, []db.Record{record}, aws.StringValue(out.ChangeInfo.Id))
+	}
+
+	return resp, nil
+}
+
+// checkPrecondition checks a request's precondition against the record of the given type at fqdn that it changes, which
+// has no ID if it doesn't exist. It only checks the record as it was read. Changes made with a precondition must also be
+// made conditionally, so that only one of several concurrent requests made with the same precondition succeeds.
+func (b *backend) checkPrecondition(fqdn, rType string, record db.Record, precondition model.Precondition) error {
+	var etag string
+	if record.ID != 0 {
+		etag = model.ETag(record.Revision)
+	}
+	if !precondition.Met(etag) {
+		return fmt.Errorf("%w: %v record %v doesn't match the request's precondition", ErrPreconditionFailed, rType, fqdn)
+	}
+	return nil
 }
 
+// newRecord validates input against the server's limits and the records already at the FQDN and builds the record to
+// persist for it. The input's TTL is set to the one the record will have.
+func (b *backend) newRecord(fqdn string, domainID uint, input *model.RecordRequest, existing []db.Record) (db.Record, error) {
+	if input.Type == model.RecordTypeAlias {
+		if input.TTL != 0 {
+			return db.Record{}, fmt.Errorf("%w: alias records can't have a ttl", ErrInvalidRecord)
+		}
+	} else {
+		if input.TTL != 0 && (input.TTL < b.recordMinTTLSeconds || input.TTL > b.recordMaxTTLSeconds) {
+			return db.Record{}, fmt.Errorf("%w: ttl must be between %v and %v seconds",
+				ErrInvalidRecord, b.recordMinTTLSeconds, b.recordMaxTTLSeconds)
+		}
+		input.TTL = b.effectiveTTL(input.TTL)
+	}
+
+	record := db.Record{
+		FQDN:     fqdn,
+		Type:     input.Type,
+		DomainID: domainID,
+		Values:   db.NewRecordValues(input.Values),
+		TTL:      input.TTL,
+	}
+	if input.AliasTarget != nil {
+		record.Alias = *input.AliasTarget
+	}
+	record.SetRouting(input.RoutingPolicy)
+
+	for _, e := range existing {
+		if err := recordConflict(e, record); err != nil {
+			return db.Record{}, err
+		}
+	}
+
+	// Only the domain's own health checks can be referenced
+	if record.HealthCheckID != "" {
+		hc, err := b.db.GetHealthCheck(domainID, record.HealthCheckID)
+		if err != nil {
+			return db.Record{}, err
+		}
+		if hc.ID == 0 {
+			return db.Record{}, fmt.Errorf("%w: health check %v doesn't exist", ErrInvalidRecord, record.HealthCheckID)
+		}
+	}
+
+	return record, nil
+}
+
+// resourceRecordSet builds the Route53 record set for a record. The result is used for both UPSERTs and DELETEs, and a
+// DELETE must match the record set exactly, so everything is derived from what was persisted for the record.
+func (b *backend) resourceRecordSet(record db.Record) *route53.ResourceRecordSet {
+	rrs := &route53.ResourceRecordSet{
+		Type: aws.String(route53Type(record.Type)),
+		Name: aws.String(record.FQDN),
+	}
+
+	if record.Type == model.RecordTypeAlias {
+		rrs.AliasTarget = &route53.AliasTarget{
+			HostedZoneId:         aws.String(record.Alias.HostedZoneID),
+			DNSName:              aws.String(record.Alias.DNSName),
+			EvaluateTargetHealth: aws.Bool(record.Alias.EvaluateTargetHealth),
+		}
+	} else {
+		rr := make([]*route53.ResourceRecord, 0)
+		for _, value := range record.ValueStrings() {
+			rr = append(rr, &route53.ResourceRecord{
+				Value: aws.String(cleanRecordValue(record.Type, value)),
+			})
+		}
+		rrs.ResourceRecords = rr
+		rrs.TTL = aws.Int64(b.effectiveTTL(record.TTL))
+	}
+
+	if record.SetIdentifier != "" {
+		rrs.SetIdentifier = aws.String(record.SetIdentifier)
+		switch record.RoutingPolicy {
+		case model.RoutingPolicyWeighted:
+			rrs.Weight = aws.Int64(record.Weight)
+		case model.RoutingPolicyFailover:
+			rrs.Failover = aws.String(record.Failover)
+		}
+		if record.HealthCheckID != "" {
+			rrs.HealthCheckId = aws.String(record.HealthCheckID)
+		}
+	}
+
+	return rrs
+}
+
+// recordConflict returns an error if upserting record would clobber or be rejected because of existing, a record
+// already persisted at the same FQDN
+func recordConflict(existing, record db.Record) error {
+	if route53Type(existing.Type) != route53Type(record.Type) {
+		return nil
+	}
+	if existing.Type == record.Type && existing.SetIdentifier == record.SetIdentifier {
+		// This is an update of the existing record
+		return nil
+	}
+
+	switch {
+	case existing.SetIdentifier == "" && record.SetIdentifier == "":
+		// An alias record is an A record in Route53, so the two types can't coexist at the same name. Without this
+		// check the UPSERT of one would silently replace the other.
+		return fmt.Errorf("%w: %v already has an %v record", ErrInvalidRecord, record.FQDN, existing.Type)
+	case existing.SetIdentifier == "" || record.SetIdentifier == "":
+		return fmt.Errorf("%w: records of type %v at %v must either all or none have a routing policy",
+			ErrInvalidRecord, route53Type(record.Type), record.FQDN)
+	case existing.SetIdentifier == record.SetIdentifier:
+		return fmt.Errorf("%w: %v already has an %v record with set identifier %v",
+			ErrInvalidRecord, record.FQDN, existing.Type, existing.SetIdentifier)
+	case existing.RoutingPolicy != record.RoutingPolicy:
+		return fmt.Errorf("%w: records of type %v at %v must all use the same routing policy",
+			ErrInvalidRecord, route53Type(record.Type), record.FQDN)
+	case record.RoutingPolicy == model.RoutingPolicyFailover && existing.Failover == record.Failover:
+		return fmt.Errorf("%w: %v already has a %v failover record", ErrInvalidRecord, record.FQDN, existing.Failover)
+	}
+
+	return nil
+}
+
+// route53Type returns the type of the Route53 record set a record of type rType is created as
+func route53Type(rType string) string {
+	if rType == model.RecordTypeAlias {
+		return model.RecordTypeA
+	}
+	return rType
+}
+
+// inSync reports whether a persisted record matches what a renew request says it should be
+func (b *backend) inSync(dr db.Record, record model.RecordRequest) bool {
+	if !dr.HasValues(record.Values) || b.effectiveTTL(dr.TTL) != b.effectiveTTL(record.TTL) {
+		return false
+	}
+
+	var alias model.AliasTarget
+	if record.AliasTarget != nil {
+		alias = *record.AliasTarget
+	}
+	if dr.Alias != alias {
+		return false
+	}
+
+	// The set identifiers already match, since records are looked up by them
+	var want db.Record
+	want.SetRouting(record.RoutingPolicy)
+	return dr.RoutingPolicy == want.RoutingPolicy && dr.Weight == want.Weight && dr.Failover == want.Failover &&
+		dr.HealthCheckID == want.HealthCheckID
+}
+
+// effectiveTTL returns the TTL to use for a record. A zero TTL means none was requested (or, for records persisted
+// before TTLs were stored, that the record was created with the default), so the default applies.
+func (b *backend) effectiveTTL(ttl int64) int64 {
+	if ttl == 0 {
+		return b.recordTTLSeconds
+	}
+	return ttl
+}
+
+// cleanRecordValue converts a value as supplied in a request to the format Route53 expects
 func cleanRecordValue(rType string, value string) string {
-	if rType == model.RecordTypeTxt && !strings.HasPrefix(value, "\"") {
-		return "\"" + value + "\""
+	switch rType {
+	case model.RecordTypeTxt:
+		if !strings.HasPrefix(value, "\"") {
+			return "\"" + value + "\""
+		}
+	case model.RecordTypeMx:
+		if v, err := model.ParseMXValue(value); err == nil {
+			return v.String()
+		}
+	case model.RecordTypeSrv:
+		if v, err := model.ParseSRVValue(value); err == nil {
+			return v.String()
+		}
+	case model.RecordTypeCaa:
+		// Route53 requires the CAA value to be quoted
+		if v, err := model.ParseCAAValue(value); err == nil {
+			return v.String()
+		}
 	}
 
 	return value
@@ -0,0 +1,224 @@
+package backend
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+const route53Namespace = "https://route53.amazonaws.com/doc/2013-04-01/"
+
+// newTestBackend creates a backend backed by an empty sqlite database. It has no Route53 client unless one is set, such
+// as one from newFakeRoute53.
+func newTestBackend(t *testing.T) *backend {
+	t.Helper()
+	database, err := db.New(context.Background(), "sqlite", "file:"+filepath.Join(t.TempDir(), "test.sqlite"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &backend{db: database}
+}
+
+// fakeRecordSet is a record set as the Route53 API encodes it
+type fakeRecordSet struct {
+	Name            string   `xml:"Name"`
+	Type            string   `xml:"Type"`
+	SetIdentifier   string   `xml:"SetIdentifier,omitempty"`
+	TTL             int64    `xml:"TTL,omitempty"`
+	ResourceRecords []string `xml:"ResourceRecords>ResourceRecord>Value"`
+}
+
+// fakeRoute53 serves the parts of the Route53 API that tear down hosted zones from memory. Record sets are keyed by
+// hosted zone ID, without the /hostedzone/ prefix.
+type fakeRoute53 struct {
+	lock  sync.Mutex
+	zones map[string][]fakeRecordSet
+}
+
+// newFakeRoute53 starts a fake Route53 API holding zones and returns a client for it
+func newFakeRoute53(t *testing.T, zones map[string][]fakeRecordSet) (*fakeRoute53, *route53.Route53) {
+	t.Helper()
+	f := &fakeRoute53{zones: zones}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	s, err := session.NewSession(&aws.Config{
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, route53.New(s)
+}
+
+// recordSets returns the record sets of the hosted zone, and whether it exists
+func (f *fakeRoute53) recordSets(zoneID string) ([]fakeRecordSet, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	recordSets, ok := f.zones[zoneID]
+	return recordSets, ok
+}
+
+func (f *fakeRoute53) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/2013-04-01/hostedzone/")
+	zoneID, op, _ := strings.Cut(strings.TrimSuffix(path, "/"), "/")
+	recordSets, ok := f.zones[zoneID]
+	if !ok {
+		writeFakeRoute53Error(w, http.StatusNotFound, route53.ErrCodeNoSuchHostedZone, "No hosted zone found with ID: "+zoneID)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && op == "rrset":
+		f.listRecordSets(w, r, recordSets)
+	case r.Method == http.MethodPost && op == "rrset":
+		f.changeRecordSets(w, r, zoneID)
+	case r.Method == http.MethodDelete && op == "":
+		if len(recordSets) > 2 {
+			writeFakeRoute53Error(w, http.StatusBadRequest, route53.ErrCodeHostedZoneNotEmpty, "The hosted zone contains resource record sets")
+			return
+		}
+		delete(f.zones, zoneID)
+		writeFakeRoute53Response(w, fakeChangeResponse("DeleteHostedZoneResponse"))
+	default:
+		http.Error(w, "unsupported request", http.StatusNotImplemented)
+	}
+}
+
+// listRecordSets lists the record sets in Route53's order, starting at the requested name and type
+func (f *fakeRoute53) listRecordSets(w http.ResponseWriter, r *http.Request, recordSets []fakeRecordSet) {
+	sorted := append([]fakeRecordSet(nil), recordSets...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return fakeRecordSetOrder(sorted[i].Name, sorted[i].Type) < fakeRecordSetOrder(sorted[j].Name, sorted[j].Type)
+	})
+
+	query := r.URL.Query()
+	if name := query.Get("name"); name != "" {
+		start := fakeRecordSetOrder(name, query.Get("type"))
+		for len(sorted) > 0 && fakeRecordSetOrder(sorted[0].Name, sorted[0].Type) < start {
+			sorted = sorted[1:]
+		}
+	}
+	maxItems := len(sorted)
+	if _, err := fmt.Sscan(query.Get("maxitems"), &maxItems); err == nil && maxItems < len(sorted) {
+		sorted = sorted[:maxItems]
+	}
+
+	writeFakeRoute53Response(w, &fakeListResponse{RecordSets: sorted, MaxItems: fmt.Sprint(maxItems)})
+}
+
+// changeRecordSets applies a change batch, which fails as a whole if any of its changes do
+func (f *fakeRoute53) changeRecordSets(w http.ResponseWriter, r *http.Request, zoneID string) {
+	var req struct {
+		Changes []struct {
+			Action    string        `xml:"Action"`
+			RecordSet fakeRecordSet `xml:"ResourceRecordSet"`
+		} `xml:"ChangeBatch>Changes>Change"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recordSets := append([]fakeRecordSet(nil), f.zones[zoneID]...)
+	for _, change := range req.Changes {
+		i := 0
+		for ; i < len(recordSets); i++ {
+			rs := recordSets[i]
+			if rs.Name == change.RecordSet.Name && rs.Type == change.RecordSet.Type && rs.SetIdentifier == change.RecordSet.SetIdentifier {
+				break
+			}
+		}
+		exists := i < len(recordSets)
+		switch change.Action {
+		case route53.ChangeActionCreate, route53.ChangeActionUpsert:
+			if exists && change.Action == route53.ChangeActionCreate {
+				writeFakeRoute53Error(w, http.StatusBadRequest, route53.ErrCodeInvalidChangeBatch, "it already exists")
+				return
+			}
+			if exists {
+				recordSets[i] = change.RecordSet
+			} else {
+				recordSets = append(recordSets, change.RecordSet)
+			}
+		case route53.ChangeActionDelete:
+			if !exists {
+				writeFakeRoute53Error(w, http.StatusBadRequest, route53.ErrCodeInvalidChangeBatch, "it was not found")
+				return
+			}
+			recordSets = append(recordSets[:i], recordSets[i+1:]...)
+		}
+	}
+	f.zones[zoneID] = recordSets
+	writeFakeRoute53Response(w, fakeChangeResponse("ChangeResourceRecordSetsResponse"))
+}
+
+// fakeRecordSetOrder is the key Route53 sorts record sets by: the name's labels in reverse order, then the type
+func fakeRecordSetOrder(name, rType string) string {
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return strings.Join(labels, ".") + " " + rType
+}
+
+type fakeListResponse struct {
+	XMLName     xml.Name        `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ListResourceRecordSetsResponse"`
+	RecordSets  []fakeRecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+	IsTruncated bool            `xml:"IsTruncated"`
+	MaxItems    string          `xml:"MaxItems"`
+}
+
+type fakeChangeInfoResponse struct {
+	XMLName     xml.Name
+	ID          string `xml:"ChangeInfo>Id"`
+	Status      string `xml:"ChangeInfo>Status"`
+	SubmittedAt string `xml:"ChangeInfo>SubmittedAt"`
+}
+
+// fakeChangeResponse returns the response named name, which describes a change
+func fakeChangeResponse(name string) *fakeChangeInfoResponse {
+	return &fakeChangeInfoResponse{
+		XMLName:     xml.Name{Space: route53Namespace, Local: name},
+		ID:          "/change/C1",
+		Status:      route53.ChangeStatusPending,
+		SubmittedAt: "2023-01-01T00:00:00Z",
+	}
+}
+
+func writeFakeRoute53Response(w http.ResponseWriter, body interface{}) {
+	out, err := xml.Marshal(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(out)
+}
+
+func writeFakeRoute53Error(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><ErrorResponse xmlns="%v"><Error><Type>Sender</Type>`+
+		`<Code>%v</Code><Message>%v</Message></Error><RequestId>1</RequestId></ErrorResponse>`, route53Namespace, code, message)
+}
@@ -0,0 +1,134 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/acorn-io/acorn-dns/pkg/policy"
+	"github.com/acorn-io/acorn-dns/pkg/rand"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	invitationCodeLength = 32
+	// minVanitySlugLength keeps requested slugs from using up the shortest names
+	minVanitySlugLength = 3
+)
+
+// SlugAvailability reports whether a domain could be created with the given slug
+func (b *backend) SlugAvailability(slug, invitationCode string) (model.SlugAvailabilityResponse, error) {
+	if !b.vanitySlugs {
+		if invitationCode == "" {
+			return model.SlugAvailabilityResponse{}, fmt.Errorf("%w: an invitation code is required", ErrForbidden)
+		}
+		invitation, err := b.db.GetInvitationByCodeHash(hashInvitationCode(invitationCode))
+		if err != nil {
+			return model.SlugAvailabilityResponse{}, err
+		}
+		if invitation.ID == 0 || invitation.RemainingUses <= 0 {
+			return model.SlugAvailabilityResponse{}, fmt.Errorf("%w: %v", ErrForbidden, db.ErrInvalidInvitation)
+		}
+	}
+
+	resp := model.SlugAvailabilityResponse{Slug: slug}
+
+	rules, err := b.operatorRules()
+	if err != nil {
+		return model.SlugAvailabilityResponse{}, err
+	}
+	if err := b.checkVanitySlug(slug, rules); err != nil {
+		resp.Reason = strings.TrimPrefix(err.Error(), ErrInvalidSlug.Error()+": ")
+		return resp, nil
+	}
+
+	taken, err := b.db.IsSlugTaken(slug)
+	if err != nil {
+		return model.SlugAvailabilityResponse{}, err
+	}
+	if taken {
+		resp.Reason = fmt.Sprintf("slug %v is taken", slug)
+		return resp, nil
+	}
+
+	resp.Available = true
+	return resp, nil
+}
+
+func (b *backend) GetInvitations() ([]model.InvitationResponse, error) {
+	invitations, err := b.db.GetInvitations()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]model.InvitationResponse, 0, len(invitations))
+	for _, i := range invitations {
+		resp = append(resp, model.InvitationResponse{ID: i.ID, RemainingUses: i.RemainingUses})
+	}
+	return resp, nil
+}
+
+// CreateInvitation creates an invitation that can be used to request a slug the given number of times. The code is only
+// ever returned here.
+func (b *backend) CreateInvitation(uses int64) (model.InvitationResponse, error) {
+	code := rand.StringWithAll(invitationCodeLength)
+	invitation, err := b.db.CreateInvitation(db.Invitation{
+		CodeHash:      hashInvitationCode(code),
+		RemainingUses: uses,
+	})
+	if err != nil {
+		return model.InvitationResponse{}, err
+	}
+
+	return model.InvitationResponse{
+		ID:            invitation.ID,
+		Code:          code,
+		RemainingUses: invitation.RemainingUses,
+	}, nil
+}
+
+func (b *backend) DeleteInvitation(id uint) error {
+	deleted, err := b.db.DeleteInvitation(id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("%w: invitation %v", ErrNotFound, id)
+	}
+	return nil
+}
+
+// vanitySlugAccess checks whether a slug can be requested and returns the hash of the invitation code whose use must be
+// consumed by creating the domain, if any
+func (b *backend) vanitySlugAccess(invitationCode string) (string, error) {
+	if b.vanitySlugs {
+		return "", nil
+	}
+	if invitationCode == "" {
+		return "", fmt.Errorf("%w: requesting a slug requires an invitation code", ErrForbidden)
+	}
+	return hashInvitationCode(invitationCode), nil
+}
+
+// checkVanitySlug checks that a requested slug is a valid DNS label that the name policy allows
+func (b *backend) checkVanitySlug(slug string, rules policy.Rules) error {
+	if errs := validation.IsDNS1123Label(slug); len(errs) > 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidSlug, strings.Join(errs, ", "))
+	}
+	if len(slug) < minVanitySlugLength {
+		return fmt.Errorf("%w: slug must be at least %v characters", ErrInvalidSlug, minVanitySlugLength)
+	}
+	if err := b.policy.CheckSlug(slug, rules); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSlug, err)
+	}
+	return nil
+}
+
+// hashInvitationCode returns the hash invitation codes are stored as. The codes are random, so a fast hash is enough.
+func hashInvitationCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
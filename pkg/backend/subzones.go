@@ -0,0 +1,222 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/sirupsen/logrus"
+)
+
+const recordTypeNS = "NS"
+
+// subZone returns the domain's own hosted zone
+func subZone(domain db.Domain) zone {
+	return zone{
+		name: strings.TrimPrefix(domain.Domain, "."),
+		id:   domain.SubZoneID,
+	}
+}
+
+// createSubZone creates a hosted zone for just the domain and delegates to it from parent with NS records. The zone's
+// ID is saved as soon as it exists, so that it's torn down along with the domain even if delegating to it fails. If
+// saving it fails, the zone is deleted right away, since nothing would ever tear it down.
+func (b *backend) createSubZone(domain db.Domain, parent zone) error {
+	name := strings.TrimPrefix(domain.Domain, ".")
+	out, err := b.Svc.CreateHostedZone(&route53.CreateHostedZoneInput{
+		Name:            aws.String(name),
+		CallerReference: aws.String(fmt.Sprintf("acorn-dns-%v-%v", domain.ID, time.Now().UnixNano())),
+		HostedZoneConfig: &route53.HostedZoneConfig{
+			Comment: aws.String("Managed by acorn-dns"),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create route53 hosted zone %v with error %v", name, err)
+	}
+
+	if err := b.db.SetDomainSubZone(domain.ID, aws.StringValue(out.HostedZone.Id)); err != nil {
+		// The zone is new, so it has nothing but its own NS and SOA records and can be deleted as it is
+		if _, delErr := b.Svc.DeleteHostedZone(&route53.DeleteHostedZoneInput{Id: out.HostedZone.Id}); delErr != nil {
+			logrus.Errorf("Unable to delete hosted zone %v of domain %v, which is left behind. Error: %v",
+				aws.StringValue(out.HostedZone.Id), domain.Domain, delErr)
+		}
+		return err
+	}
+
+	var nameServers []*route53.ResourceRecord
+	for _, ns := range out.DelegationSet.NameServers {
+		nameServers = append(nameServers, &route53.ResourceRecord{Value: ns})
+	}
+
+	_, err = b.Svc.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(parent.id),
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: []*route53.Change{
+				{
+					Action: aws.String("UPSERT"),
+					ResourceRecordSet: &route53.ResourceRecordSet{
+						Name:            aws.String(name),
+						Type:            aws.String(recordTypeNS),
+						TTL:             aws.Int64(b.recordTTLSeconds),
+						ResourceRecords: nameServers,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delegate to route53 hosted zone %v with error %v", name, err)
+	}
+
+	logrus.Infof("Created hosted zone %v for domain %v", aws.StringValue(out.HostedZone.Id), domain.Domain)
+	return nil
+}
+
+// purgeSubZoneRecords deletes the purged records of domains that have their own hosted zones from those zones. Unlike
+// the served zones, which are listed in full to find what to purge, the hosted zones of domains are only ever changed
+// through the API, so the database is trusted to know what they hold. Listing every one of them on every purge would
+// soon run into Route53's limit of five requests a second.
+func (b *backend) purgeSubZoneRecords(records []db.Record) {
+	recordsByDomain := make(map[uint][]db.Record)
+	for _, r := range records {
+		recordsByDomain[r.DomainID] = append(recordsByDomain[r.DomainID], r)
+	}
+
+	for domainID, domainRecords := range recordsByDomain {
+		domain, err := b.db.GetDomainByID(domainID)
+		if err != nil {
+			logrus.Errorf("Could not load domain %v from database. Error: %v", domainID, err)
+			continue
+		}
+		if domain.SubZoneID == "" {
+			continue
+		}
+		if err := b.deleteRecordSets(subZone(domain), domainRecords); err != nil {
+			logrus.Errorf("Unable to purge records from hosted zone of domain %v. Error: %v", domain.Domain, err)
+		}
+	}
+}
+
+// teardownSubZones deletes the hosted zones of deleted domains, along with their delegations
+func (b *backend) teardownSubZones() {
+	domains, err := b.db.GetDeletedSubZoneDomains()
+	if err != nil {
+		logrus.Errorf("Could not load deleted domains with hosted zones from database. Error: %v", err)
+		return
+	}
+
+	for _, domain := range domains {
+		if err := b.deleteSubZone(domain); err != nil {
+			logrus.Errorf("Unable to delete hosted zone of domain %v. Error: %v", domain.Domain, err)
+			continue
+		}
+		logrus.Infof("Deleted hosted zone %v of domain %v", domain.SubZoneID, domain.Domain)
+	}
+}
+
+// deleteSubZone deletes the domain's own hosted zone and removes its delegation from the domain's zone
+func (b *backend) deleteSubZone(domain db.Domain) error {
+	if err := b.deleteHostedZone(subZone(domain)); err != nil {
+		return err
+	}
+
+	if err := b.deleteDelegation(domain); err != nil {
+		return err
+	}
+
+	return b.db.SetDomainSubZone(domain.ID, "")
+}
+
+// deleteHostedZone empties and deletes the hosted zone, unless it's already gone. A hosted zone can only be deleted once
+// it has nothing but its own NS and SOA records.
+func (b *backend) deleteHostedZone(z zone) error {
+	var changes []*route53.Change
+	err := b.Svc.ListResourceRecordSetsPages(&route53.ListResourceRecordSetsInput{HostedZoneId: aws.String(z.id)},
+		func(page *route53.ListResourceRecordSetsOutput, lastPage bool) bool {
+			for _, recordSet := range page.ResourceRecordSets {
+				rType := aws.StringValue(recordSet.Type)
+				if strings.TrimSuffix(aws.StringValue(recordSet.Name), ".") == z.name &&
+					(rType == recordTypeNS || rType == route53.RRTypeSoa) {
+					continue
+				}
+				changes = append(changes, &route53.Change{
+					Action:            aws.String("DELETE"),
+					ResourceRecordSet: recordSet,
+				})
+			}
+			return true
+		})
+	if isNoSuchHostedZone(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if len(changes) > 0 {
+		_, err := b.Svc.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(z.id),
+			ChangeBatch: &route53.ChangeBatch{
+				Changes: changes,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = b.Svc.DeleteHostedZone(&route53.DeleteHostedZoneInput{Id: aws.String(z.id)})
+	if isNoSuchHostedZone(err) {
+		return nil
+	}
+	return err
+}
+
+// deleteDelegation removes the NS records delegating to the domain's own hosted zone from the domain's zone, if they
+// exist
+func (b *backend) deleteDelegation(domain db.Domain) error {
+	parent, err := b.servedZone(domain.Zone)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimPrefix(domain.Domain, ".")
+
+	out, err := b.Svc.ListResourceRecordSets(&route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(parent.id),
+		StartRecordName: aws.String(name),
+		StartRecordType: aws.String(recordTypeNS),
+		MaxItems:        aws.String("1"),
+	})
+	if err != nil {
+		return err
+	}
+	if len(out.ResourceRecordSets) == 0 {
+		return nil
+	}
+	recordSet := out.ResourceRecordSets[0]
+	if strings.TrimSuffix(aws.StringValue(recordSet.Name), ".") != name || aws.StringValue(recordSet.Type) != recordTypeNS {
+		return nil
+	}
+
+	_, err = b.Svc.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(parent.id),
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: []*route53.Change{
+				{
+					Action:            aws.String("DELETE"),
+					ResourceRecordSet: recordSet,
+				},
+			},
+		},
+	})
+	return err
+}
+
+func isNoSuchHostedZone(err error) bool {
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == route53.ErrCodeNoSuchHostedZone
+}
@@ -0,0 +1,100 @@
+package backend
+
+import (
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestTeardownSubZones(t *testing.T) {
+	const (
+		parentID = "/hostedzone/ZPARENT"
+		subID    = "/hostedzone/ZSUB"
+	)
+	subZoneRecordSets := []fakeRecordSet{
+		{Name: "abc123.example.com.", Type: "SOA", TTL: 900, ResourceRecords: []string{"ns-1.example.net. admin.example.net. 1 7200 900 1209600 86400"}},
+		{Name: "abc123.example.com.", Type: "NS", TTL: 172800, ResourceRecords: []string{"ns-1.example.net."}},
+		{Name: "www.abc123.example.com.", Type: "A", TTL: 300, ResourceRecords: []string{"1.1.1.1"}},
+		{Name: "abc123.example.com.", Type: "TXT", TTL: 300, ResourceRecords: []string{`"hello"`}},
+	}
+	delegation := fakeRecordSet{Name: "abc123.example.com.", Type: "NS", TTL: 300, ResourceRecords: []string{"ns-1.example.net."}}
+	unrelated := []fakeRecordSet{
+		{Name: "abc123.example.com.", Type: "TXT", TTL: 300, ResourceRecords: []string{`"not a delegation"`}},
+		{Name: "def456.example.com.", Type: "NS", TTL: 300, ResourceRecords: []string{"ns-2.example.net."}},
+	}
+
+	tests := []struct {
+		name          string
+		deleted       bool
+		subZone       bool
+		delegated     bool
+		wantTornDown  bool
+		wantSubZoneID string
+	}{
+		{name: "deleted domain", deleted: true, subZone: true, delegated: true, wantTornDown: true},
+		{name: "hosted zone already gone", deleted: true, delegated: true, wantTornDown: true},
+		{name: "delegation already gone", deleted: true, subZone: true, wantTornDown: true},
+		{name: "live domain", subZone: true, delegated: true, wantSubZoneID: subID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zones := map[string][]fakeRecordSet{"ZPARENT": append([]fakeRecordSet(nil), unrelated...)}
+			if tt.subZone {
+				zones["ZSUB"] = append([]fakeRecordSet(nil), subZoneRecordSets...)
+			}
+			if tt.delegated {
+				zones["ZPARENT"] = append(zones["ZPARENT"], delegation)
+			}
+			fake, svc := newFakeRoute53(t, zones)
+
+			b := newTestBackend(t)
+			b.Svc = svc
+			b.zones = []zone{{name: "example.com", id: parentID}}
+			domain, err := b.db.CreateSubDomainWithSlug("hash", "example.com", "abc123", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := b.db.SetDomainSubZone(domain.ID, subID); err != nil {
+				t.Fatal(err)
+			}
+			if tt.deleted {
+				if err := b.db.DeleteDomain(domain.ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			b.teardownSubZones()
+
+			domain, err = b.db.GetDomainByID(domain.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if domain.SubZoneID != tt.wantSubZoneID {
+				t.Errorf("sub-zone ID = %q, want %q", domain.SubZoneID, tt.wantSubZoneID)
+			}
+			if _, ok := fake.recordSets("ZSUB"); tt.subZone && ok == tt.wantTornDown {
+				t.Errorf("hosted zone exists = %v, want %v", ok, !tt.wantTornDown)
+			}
+			parent, _ := fake.recordSets("ZPARENT")
+			if got := slices.ContainsFunc(parent, func(rs fakeRecordSet) bool {
+				return rs.Name == delegation.Name && rs.Type == delegation.Type
+			}); got != (tt.delegated && !tt.wantTornDown) {
+				t.Errorf("delegation exists = %v, want %v", got, tt.delegated && !tt.wantTornDown)
+			}
+			for _, rs := range unrelated {
+				if !slices.ContainsFunc(parent, func(p fakeRecordSet) bool { return p.Name == rs.Name && p.Type == rs.Type }) {
+					t.Errorf("%v %v was deleted from the parent zone", rs.Name, rs.Type)
+				}
+			}
+
+			// Once its hosted zone is torn down, nothing keeps the domain from being deleted for good
+			erased, err := b.db.PurgeDeletedDomains(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(erased) == 1 != tt.wantTornDown {
+				t.Errorf("domains deleted for good = %v, want the domain deleted for good = %v", len(erased), tt.wantTornDown)
+			}
+		})
+	}
+}
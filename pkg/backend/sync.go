@@ -0,0 +1,130 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+)
+
+// SyncRecords makes the domain's records match records, which is the complete set of records the domain should have.
+// Missing and changed records are upserted and the domain's other records are deleted, all at once as a batch. Records
+// holding ACME challenge values are managed through the ACME endpoints and are left alone. Like Renew, it also marks
+// the domain and the desired records as checked in.
+//
+// Changes too many for a single batch are made in several, one after the other. If one of them fails, the ones before
+// it stay applied, and syncing again makes the rest of the changes.
+func (b *backend) SyncRecords(domain string, domainID uint, records []model.RecordRequest, version string, actor model.Actor) (model.RecordSyncResponse, error) {
+	domainRecords, err := b.db.GetDomainRecords(domainID)
+	if err != nil {
+		return model.RecordSyncResponse{}, err
+	}
+
+	resp := model.RecordSyncResponse{Name: domain}
+	desired := make(map[model.FQDNTypePair]bool, len(records))
+	var (
+		pairs   []model.FQDNTypePair
+		upserts []model.RecordBatchOperation
+	)
+	for _, record := range records {
+		pair := model.FQDNTypePair{FQDN: record.Name + domain, Type: record.Type, SetIdentifier: record.SetIdentifier()}
+		if desired[pair] {
+			return model.RecordSyncResponse{}, fmt.Errorf("%w: %v record %v is listed more than once", ErrInvalidRecord, pair.Type, pair.FQDN)
+		}
+		desired[pair] = true
+		pairs = append(pairs, pair)
+
+		existing, ok := domainRecords[pair]
+		switch {
+		case !ok:
+			upserts = append(upserts, model.RecordBatchOperation{Action: model.BatchActionCreate, RecordRequest: record})
+			resp.Created = append(resp.Created, pair)
+		case !b.inSync(existing, record):
+			upserts = append(upserts, model.RecordBatchOperation{Action: model.BatchActionUpdate, RecordRequest: record})
+			resp.Updated = append(resp.Updated, pair)
+		}
+	}
+
+	var deletes []model.RecordBatchOperation
+	for pair, r := range domainRecords {
+		if desired[pair] || hasExpiringValues(r) {
+			continue
+		}
+		resp.Deleted = append(resp.Deleted, pair)
+	}
+	sort.Slice(resp.Deleted, func(i, j int) bool {
+		return resp.Deleted[i].FQDN+resp.Deleted[i].Type+resp.Deleted[i].SetIdentifier <
+			resp.Deleted[j].FQDN+resp.Deleted[j].Type+resp.Deleted[j].SetIdentifier
+	})
+	for _, pair := range resp.Deleted {
+		deletes = append(deletes, model.RecordBatchOperation{
+			Action: model.BatchActionDelete,
+			RecordRequest: model.RecordRequest{
+				Name:          strings.TrimSuffix(pair.FQDN, domain),
+				Type:          pair.Type,
+				RoutingPolicy: domainRecords[pair].Routing(),
+			},
+		})
+	}
+
+	// Deletes go first, so that a name can switch to a type that can't coexist with the one it had
+	for _, ops := range syncBatches(append(deletes, upserts...)) {
+		_, err := b.applyRecordBatch(domain, domainID, ops, actor, model.AuditRecordsSync)
+		var batchErr *BatchError
+		if errors.As(err, &batchErr) {
+			// The operations were built from the request, so report the first problem with the request
+			for _, err := range batchErr.Errors {
+				if err != nil {
+					return model.RecordSyncResponse{}, err
+				}
+			}
+		}
+		if err != nil {
+			return model.RecordSyncResponse{}, err
+		}
+	}
+
+	if err := b.db.Renew(domainID, pairs, version); err != nil {
+		return model.RecordSyncResponse{}, err
+	}
+
+	return resp, nil
+}
+
+// syncBatches splits the operations of a sync into batches that are each within the limits of a batch. Every operation of
+// a sync changes exactly one record set.
+func syncBatches(ops []model.RecordBatchOperation) [][]model.RecordBatchOperation {
+	var (
+		batches [][]model.RecordBatchOperation
+		start   int
+		size    int
+	)
+	for i, op := range ops {
+		opSize := changeSize("CREATE")
+		if op.Action == model.BatchActionUpdate {
+			opSize = changeSize("UPSERT")
+		}
+		if i-start == maxBatchOperations || size+opSize > maxBatchChanges {
+			batches = append(batches, ops[start:i])
+			start, size = i, 0
+		}
+		size += opSize
+	}
+	if start < len(ops) {
+		batches = append(batches, ops[start:])
+	}
+	return batches
+}
+
+// hasExpiringValues reports whether a record holds values that expire, which only the ACME challenge records do
+func hasExpiringValues(r db.Record) bool {
+	for _, v := range r.Values {
+		if v.ExpiresAt != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,308 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/acorn-io/acorn-dns/pkg/rand"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	webhookSecretLength = 32
+	// maxWebhookSubscriptionsPerDomain keeps a domain from fanning its events out to an unbounded number of URLs
+	maxWebhookSubscriptionsPerDomain = 10
+
+	webhookDeliveryInterval  = 5 * time.Second
+	webhookDeliveryBatchSize = 50
+	// webhookDeliveryConcurrency is how many of a batch's deliveries are attempted at once
+	webhookDeliveryConcurrency = 10
+	webhookDeliveryTimeout     = 10 * time.Second
+	// webhookDeliveryLease is how long a claimed delivery is kept from being claimed again. It must be longer than
+	// attempting a whole batch can take, so it's twice that.
+	webhookDeliveryLease = 2 * webhookDeliveryBatchSize / webhookDeliveryConcurrency * webhookDeliveryTimeout
+	// Failed deliveries are retried with exponential backoff, starting at webhookMinRetryDelay, until they run out of
+	// attempts
+	webhookMinRetryDelay       = 10 * time.Second
+	webhookMaxRetryDelay       = time.Hour
+	webhookMaxDeliveryAttempts = 10
+)
+
+// newWebhookClient returns the client webhooks are delivered with. Unless allowPrivateAddresses is set, it refuses to
+// connect to loopback, private and link-local addresses, since anyone with a domain can choose where its webhooks go.
+func newWebhookClient(allowPrivateAddresses bool) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookDeliveryTimeout}
+	if !allowPrivateAddresses {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+				return fmt.Errorf("webhooks can't be delivered to %v", host)
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: webhookDeliveryTimeout,
+		// No proxy is used, since the addresses that are connected to must be the webhooks' own
+		Transport: &http.Transport{
+			DialContext: dialer.DialContext,
+		},
+		// Redirects could lead anywhere, so they are treated as failed deliveries
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// CreateWebhookSubscription subscribes a URL to the events of the domain with the given ID, or to all events if domainID
+// is 0. The returned secret, which deliveries are signed with, is only ever returned here.
+func (b *backend) CreateWebhookSubscription(domainID uint, input model.WebhookRequest) (model.WebhookResponse, error) {
+	u, err := url.Parse(input.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return model.WebhookResponse{}, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	for _, event := range input.Events {
+		if !slices.Contains(model.WebhookEvents, event) {
+			return model.WebhookResponse{}, fmt.Errorf("%w: unknown event %v", ErrInvalidWebhook, event)
+		}
+	}
+
+	if domainID != 0 {
+		existing, err := b.db.GetWebhookSubscriptions(domainID)
+		if err != nil {
+			return model.WebhookResponse{}, err
+		}
+		if len(existing) >= maxWebhookSubscriptionsPerDomain {
+			return model.WebhookResponse{}, fmt.Errorf("%w: a domain can't have more than %v webhooks",
+				ErrQuotaExceeded, maxWebhookSubscriptionsPerDomain)
+		}
+	}
+
+	subscription := db.WebhookSubscription{
+		URL:    input.URL,
+		Secret: rand.StringWithAll(webhookSecretLength),
+		Events: strings.Join(input.Events, ","),
+	}
+	if domainID != 0 {
+		subscription.DomainID = &domainID
+	}
+	subscription, err = b.db.CreateWebhookSubscription(subscription)
+	if err != nil {
+		return model.WebhookResponse{}, err
+	}
+
+	resp := webhookResponse(subscription)
+	resp.Secret = subscription.Secret
+	return resp, nil
+}
+
+// GetWebhookSubscriptions returns the subscriptions of the domain with the given ID, or the global ones if domainID is 0
+func (b *backend) GetWebhookSubscriptions(domainID uint) ([]model.WebhookResponse, error) {
+	subscriptions, err := b.db.GetWebhookSubscriptions(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]model.WebhookResponse, 0, len(subscriptions))
+	for _, s := range subscriptions {
+		resp = append(resp, webhookResponse(s))
+	}
+	return resp, nil
+}
+
+// DeleteWebhookSubscription deletes a subscription of the domain with the given ID, or a global one if domainID is 0.
+// Its pending deliveries are dropped.
+func (b *backend) DeleteWebhookSubscription(domainID uint, id uint) error {
+	deleted, err := b.db.DeleteWebhookSubscription(domainID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("%w: webhook %v", ErrNotFound, id)
+	}
+	return nil
+}
+
+func webhookResponse(subscription db.WebhookSubscription) model.WebhookResponse {
+	resp := model.WebhookResponse{
+		ID:  subscription.ID,
+		URL: subscription.URL,
+	}
+	if subscription.Events != "" {
+		resp.Events = strings.Split(subscription.Events, ",")
+	}
+	return resp
+}
+
+// emit adds deliveries of the event to the outbox for the subscriptions that want it. Failing to do so doesn't fail
+// what caused the event, so errors are only logged.
+func (b *backend) emit(domainID uint, domainName, event string, data interface{}) {
+	payload, err := json.Marshal(model.WebhookPayload{
+		ID:         rand.StringWithSmall(webhookSecretLength),
+		Event:      event,
+		Domain:     domainName,
+		OccurredAt: time.Now().UTC().Format(time.RFC3339),
+		Data:       data,
+	})
+	if err != nil {
+		logrus.Errorf("Unable to marshal %v event. Error: %v", event, err)
+		return
+	}
+
+	if err := b.db.EnqueueWebhookDeliveries(domainID, event, payload); err != nil {
+		logrus.Errorf("Unable to enqueue webhook deliveries of %v event. Error: %v", event, err)
+	}
+}
+
+// deliverWebhooks attempts the deliveries in the outbox that are due. A slow webhook only holds up the batch as much as
+// its timeout allows, since the deliveries are attempted concurrently.
+func (b *backend) deliverWebhooks() {
+	deliveries, subscriptions, err := b.db.ClaimWebhookDeliveries(webhookDeliveryBatchSize, webhookDeliveryLease)
+	if err != nil {
+		logrus.Errorf("Could not load webhook deliveries from database. Error: %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, webhookDeliveryConcurrency)
+	for _, delivery := range deliveries {
+		subscription, ok := subscriptions[delivery.SubscriptionID]
+		if !ok {
+			// The subscription was deleted after the delivery was claimed
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(delivery db.WebhookDelivery) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			b.attemptWebhookDelivery(subscription, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+}
+
+// attemptWebhookDelivery sends a delivery and then either deletes it from the outbox or schedules its next attempt
+func (b *backend) attemptWebhookDelivery(subscription db.WebhookSubscription, delivery db.WebhookDelivery) {
+	err := b.sendWebhook(subscription, delivery)
+	if err == nil {
+		if err := b.db.DeleteWebhookDelivery(delivery); err != nil {
+			logrus.Errorf("Unable to delete webhook delivery %v. Error: %v", delivery.ID, err)
+		}
+		return
+	}
+
+	delivery.Attempts++
+	if delivery.Attempts >= webhookMaxDeliveryAttempts {
+		logrus.Warnf("Giving up on delivering %v event to webhook %v after %v attempts. Error: %v",
+			delivery.Event, subscription.ID, delivery.Attempts, err)
+		if err := b.db.DeleteWebhookDelivery(delivery); err != nil {
+			logrus.Errorf("Unable to delete webhook delivery %v. Error: %v", delivery.ID, err)
+		}
+		return
+	}
+
+	delivery.NextAttemptAt = time.Now().Add(webhookRetryDelay(delivery.Attempts))
+	delivery.LastError = err.Error()
+	if err := b.db.RescheduleWebhookDelivery(delivery); err != nil {
+		logrus.Errorf("Unable to reschedule webhook delivery %v. Error: %v", delivery.ID, err)
+	}
+}
+
+// purgeWebhookSubscriptions deletes the subscriptions of deleted domains once their last deliveries, such as that of
+// the domain.purged event, are done
+func (b *backend) purgeWebhookSubscriptions() {
+	deleted, err := b.db.PurgeDeletedDomainsWebhookSubscriptions()
+	if err != nil {
+		logrus.Errorf("problem purging webhook subscriptions of deleted domains: %v", err)
+		return
+	}
+	logrus.Infof("Webhook subscriptions of deleted domains purged from DB: %v", deleted)
+}
+
+func (b *backend) sendWebhook(subscription db.WebhookSubscription, delivery db.WebhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, []byte(subscription.Secret))
+	mac.Write(delivery.Payload)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Acorn-DNS-Event", delivery.Event)
+	req.Header.Set("X-Acorn-DNS-Delivery", fmt.Sprint(delivery.ID))
+	req.Header.Set("X-Acorn-DNS-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := b.webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %v", resp.StatusCode)
+	}
+	return nil
+}
+
+// webhookRetryDelay returns how long to wait before the next attempt of a delivery that has failed attempts times
+func webhookRetryDelay(attempts int64) time.Duration {
+	delay := webhookMinRetryDelay
+	for i := int64(1); i < attempts && delay < webhookMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > webhookMaxRetryDelay {
+		delay = webhookMaxRetryDelay
+	}
+	return delay
+}
+
+// emitRecordChanges emits the events of a change to a domain's records: record.deleted for the records it removed and
+// record.created for each record it created or updated
+func (b *backend) emitRecordChanges(domainID uint, domain string, removed, persisted []db.Record) {
+	if len(removed) > 0 {
+		b.emit(domainID, domain, model.EventRecordDeleted, model.WebhookRecordsData{Records: recordPairs(removed)})
+	}
+	for _, r := range persisted {
+		resp := recordResponse(r)
+		resp.Name = strings.TrimSuffix(r.FQDN, domain)
+		if r.ID != 0 {
+			resp.ETag = model.ETag(r.Revision)
+		}
+		b.emit(domainID, domain, model.EventRecordCreated, resp)
+	}
+}
+
+// recordPairs returns the keys of the records' record sets, for the data of events
+func recordPairs(records []db.Record) []model.FQDNTypePair {
+	pairs := make([]model.FQDNTypePair, 0, len(records))
+	for _, r := range records {
+		pairs = append(pairs, r.Pair())
+	}
+	return pairs
+}
@@ -0,0 +1,99 @@
+package backend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/acorn-io/acorn-dns/pkg/model"
+)
+
+func TestWebhookRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int64
+		want     time.Duration
+	}{
+		{attempts: 0, want: 10 * time.Second},
+		{attempts: 1, want: 10 * time.Second},
+		{attempts: 2, want: 20 * time.Second},
+		{attempts: 3, want: 40 * time.Second},
+		{attempts: 6, want: 320 * time.Second},
+		{attempts: 9, want: 2560 * time.Second},
+		{attempts: 10, want: time.Hour},
+		{attempts: 100, want: time.Hour},
+		{attempts: 1 << 40, want: time.Hour},
+	}
+	for _, tt := range tests {
+		if got := webhookRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("webhookRetryDelay(%v) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestDeliverWebhooks(t *testing.T) {
+	var lock sync.Mutex
+	received := map[string][]string{}
+	var failedDeliveryID uint
+	handler := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+			received[r.URL.Path] = append(received[r.URL.Path], r.Header.Get("X-Acorn-DNS-Event"))
+			if status != http.StatusNoContent {
+				id, _ := strconv.ParseUint(r.Header.Get("X-Acorn-DNS-Delivery"), 10, 64)
+				failedDeliveryID = uint(id)
+			}
+			w.WriteHeader(status)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/ok", handler(http.StatusNoContent))
+	mux.Handle("/failing", handler(http.StatusInternalServerError))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	b := newTestBackend(t)
+	b.webhookClient = newWebhookClient(true)
+	for _, path := range []string{"/ok", "/failing"} {
+		if _, err := b.db.CreateWebhookSubscription(db.WebhookSubscription{URL: server.URL + path}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.emit(1, ".abc123.example.com", model.EventDomainCreated, nil)
+
+	// Each step delivers what's due and adds to what the webhooks received
+	tests := []struct {
+		name string
+		// dueAfter, if set, makes the failed delivery due right away as if it had failed that many attempts
+		dueAfter    int64
+		wantOK      int
+		wantFailing int
+	}{
+		{name: "first attempt", wantOK: 1, wantFailing: 1},
+		{name: "failed delivery isn't due yet", wantOK: 1, wantFailing: 1},
+		{name: "failed delivery is retried once due", dueAfter: 1, wantOK: 1, wantFailing: 2},
+		{name: "last attempt", dueAfter: webhookMaxDeliveryAttempts - 1, wantOK: 1, wantFailing: 3},
+		{name: "given up after the last attempt", dueAfter: webhookMaxDeliveryAttempts, wantOK: 1, wantFailing: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.dueAfter > 0 {
+				err := b.db.RescheduleWebhookDelivery(db.WebhookDelivery{ID: failedDeliveryID, Attempts: tt.dueAfter, NextAttemptAt: time.Now()})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			b.deliverWebhooks()
+
+			lock.Lock()
+			defer lock.Unlock()
+			if len(received["/ok"]) != tt.wantOK || len(received["/failing"]) != tt.wantFailing {
+				t.Errorf("received %v, want %v deliveries to /ok and %v to /failing", received, tt.wantOK, tt.wantFailing)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// zone is a Route53 hosted zone that domains can be created in
+type zone struct {
+	name string
+	id   string
+	// customDomains is set for zones that only hold custom domains, which are never given slugs in the zone
+	customDomains bool
+}
+
+// loadZones looks up the hosted zones with the given IDs. The first one is the default zone. The zones with
+// customDomainIDs come last.
+func loadZones(svc *route53.Route53, ids, customDomainIDs []string) ([]zone, error) {
+	zones := make([]zone, 0, len(ids)+len(customDomainIDs))
+	names := make(map[string]bool, len(ids)+len(customDomainIDs))
+	for i, id := range append(ids, customDomainIDs...) {
+		z, err := svc.GetHostedZone(&route53.GetHostedZoneInput{
+			Id: aws.String(id),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimSuffix(aws.StringValue(z.HostedZone.Name), ".")
+		if names[name] {
+			return nil, fmt.Errorf("more than one hosted zone is named %v", name)
+		}
+		names[name] = true
+
+		zones = append(zones, zone{
+			name:          name,
+			id:            aws.StringValue(z.HostedZone.Id),
+			customDomains: i >= len(ids),
+		})
+	}
+	return zones, nil
+}
+
+func (b *backend) GetZones() []model.ZoneResponse {
+	resp := make([]model.ZoneResponse, 0, len(b.zones))
+	for i, z := range b.zones {
+		if !z.customDomains {
+			resp = append(resp, model.ZoneResponse{Name: z.name, Default: i == 0})
+		}
+	}
+	return resp
+}
+
+// zoneByName returns the zone with the given name, or the default zone if name is empty
+func (b *backend) zoneByName(name string) (zone, error) {
+	if name == "" {
+		return b.zones[0], nil
+	}
+	for _, z := range b.zones {
+		if z.name == name && !z.customDomains {
+			return z, nil
+		}
+	}
+	return zone{}, fmt.Errorf("%w: zone %v is not served", ErrInvalidZone, name)
+}
+
+// domainZone returns the zone the records of the domain with the given ID are in, which is the domain's own hosted zone
+// if it has one
+func (b *backend) domainZone(domainID uint) (zone, error) {
+	domain, err := b.db.GetDomainByID(domainID)
+	if err != nil {
+		return zone{}, err
+	}
+	if domain.ID == 0 {
+		return zone{}, fmt.Errorf("domain %v not found", domainID)
+	}
+	if domain.SubZoneID != "" {
+		return subZone(domain), nil
+	}
+	return b.servedZone(domain.Zone)
+}
+
+// servedZone returns the served zone with the given name, including the ones that hold custom domains
+func (b *backend) servedZone(name string) (zone, error) {
+	for _, z := range b.zones {
+		if z.name == name {
+			return z, nil
+		}
+	}
+	return zone{}, fmt.Errorf("zone %v isn't served", name)
+}
+
+// isZoneName reports whether fqdn is in any of the served zones
+func (b *backend) isZoneName(fqdn string) bool {
+	for _, z := range b.zones {
+		if fqdn == z.name || strings.HasSuffix(fqdn, "."+z.name) {
+			return true
+		}
+	}
+	return false
+}
+
+// customDomainZone returns the zone that holds the custom domain with the given name
+func (b *backend) customDomainZone(name string) (zone, error) {
+	for _, z := range b.zones {
+		if z.customDomains && (name == z.name || strings.HasSuffix(name, "."+z.name)) {
+			return z, nil
+		}
+	}
+	return zone{}, fmt.Errorf("%w: %v isn't in any of the zones that hold custom domains", ErrInvalidZone, name)
+}
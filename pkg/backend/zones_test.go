@@ -0,0 +1,30 @@
+package backend
+
+import "testing"
+
+func TestIsZoneName(t *testing.T) {
+	b := &backend{zones: []zone{{name: "acorn.io"}, {name: "on.example.com"}, {name: "custom.example.org", customDomains: true}}}
+
+	tests := []struct {
+		fqdn string
+		want bool
+	}{
+		{fqdn: "acorn.io", want: true},
+		{fqdn: "abc123.acorn.io", want: true},
+		{fqdn: "www.abc123.acorn.io", want: true},
+		{fqdn: "www.abc123.on.example.com", want: true},
+		{fqdn: "www.shop.custom.example.org", want: true},
+		{fqdn: "evilacorn.io"},
+		{fqdn: "www.evilacorn.io"},
+		{fqdn: "example.com"},
+		{fqdn: "www.abc123.example.com"},
+		{fqdn: "acorn.io.evil.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fqdn, func(t *testing.T) {
+			if got := b.isZoneName(tt.fqdn); got != tt.want {
+				t.Errorf("isZoneName(%q) = %v, want %v", tt.fqdn, got, tt.want)
+			}
+		})
+	}
+}
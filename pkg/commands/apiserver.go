@@ -6,6 +6,7 @@ import (
 	"github.com/acorn-io/acorn-dns/pkg/apiserver"
 	"github.com/acorn-io/acorn-dns/pkg/backend"
 	"github.com/acorn-io/acorn-dns/pkg/db"
+	"github.com/acorn-io/acorn-dns/pkg/model"
 	"github.com/acorn-io/acorn-dns/pkg/version"
 	"github.com/rancher/wrangler/pkg/signals"
 	"github.com/sirupsen/logrus"
@@ -33,18 +34,52 @@ func (s *apiServerCommand) Execute(c *cli.Context) error {
 		return err
 	}
 
-	back, err := backend.NewBackend(
-		c.String("route53-zone-id"),
-		c.Int64("route53-record-ttl-seconds"),
-		c.Int64("purge-interval-seconds"),
-		c.Int64("domain-max-age-seconds"),
-		c.Int64("record-max-age-seconds"),
-		database)
+	back, err := backend.NewBackend(backend.Config{
+		ZoneID:                                c.String("route53-zone-id"),
+		AdditionalZoneIDs:                     c.StringSlice("route53-additional-zone-ids"),
+		CustomDomainZoneIDs:                   c.StringSlice("route53-custom-domain-zone-ids"),
+		VerificationResolver:                  c.String("verification-resolver"),
+		CustomDomainVerificationMaxAgeSeconds: c.Int64("custom-domain-verification-max-age-seconds"),
+		RecordTTLSeconds:                      c.Int64("route53-record-ttl-seconds"),
+		RecordMinTTLSeconds:                   c.Int64("record-min-ttl-seconds"),
+		RecordMaxTTLSeconds:                   c.Int64("record-max-ttl-seconds"),
+		PurgeIntervalSeconds:                  c.Int64("purge-interval-seconds"),
+		DomainMaxAgeSeconds:                   c.Int64("domain-max-age-seconds"),
+		DomainGracePeriodSeconds:              c.Int64("domain-grace-period-seconds"),
+		DeletedDomainRetentionSeconds:         c.Int64("deleted-domain-retention-seconds"),
+		AuditLogMaxAgeSeconds:                 c.Int64("audit-log-max-age-seconds"),
+		RecordMaxAgeSeconds:                   c.Int64("record-max-age-seconds"),
+		ACMEChallengeMaxAgeSeconds:            c.Int64("acme-challenge-max-age-seconds"),
+		IdempotencyKeyMaxAgeSeconds:           c.Int64("idempotency-key-max-age-seconds"),
+
+		DomainCreationIPRatePerHour:     c.Int64("domain-creation-ip-rate-per-hour"),
+		DomainCreationIPBurst:           c.Int64("domain-creation-ip-burst"),
+		DomainCreationGlobalRatePerHour: c.Int64("domain-creation-global-rate-per-hour"),
+		DomainCreationGlobalBurst:       c.Int64("domain-creation-global-burst"),
+
+		MaxRecordsPerDomain:         c.Int64("max-records-per-domain"),
+		MaxValuesPerRecord:          c.Int64("max-values-per-record"),
+		MaxRecordMutationsPerMinute: c.Int64("max-record-mutations-per-minute"),
+
+		NameRules:   nameRules(c),
+		VanitySlugs: c.Bool("vanity-slugs"),
+		SubZones:    c.Bool("sub-zones"),
+
+		DNSSECKMSKeyARN:              c.String("dnssec-kms-key-arn"),
+		WebhookAllowPrivateAddresses: c.Bool("webhook-allow-private-addresses"),
+	}, database)
 	if err != nil {
 		return err
 	}
 
-	apiServer := apiserver.NewAPIServer(ctx, log, c.Int("port"))
+	apiServer := apiserver.NewAPIServer(ctx, log, apiserver.Config{
+		Port:               c.Int("port"),
+		ACMEDNS:            c.Bool("acme-dns-api"),
+		RegistrationSecret: c.String("registration-secret"),
+		ProofOfWorkBits:    c.Int("proof-of-work-bits"),
+		AdminToken:         c.String("admin-token"),
+		TrustedProxies:     c.StringSlice("trusted-proxies"),
+	})
 
 	if err := apiServer.Start(back); err != nil {
 		return err
@@ -86,6 +121,21 @@ func constructDSN(c *cli.Context) (string, string, error) {
 	}
 }
 
+// nameRules returns the rules of the name policy given by the command line
+func nameRules(c *cli.Context) []model.NameRule {
+	var rules []model.NameRule
+	add := func(kind, flag string, regex bool) {
+		for _, pattern := range c.StringSlice(flag) {
+			rules = append(rules, model.NameRule{Kind: kind, Pattern: pattern, Regex: regex})
+		}
+	}
+	add(model.NameRuleKindSlug, "denied-slugs", false)
+	add(model.NameRuleKindSlug, "denied-slug-patterns", true)
+	add(model.NameRuleKindLabel, "denied-record-labels", false)
+	add(model.NameRuleKindLabel, "denied-record-label-patterns", true)
+	return rules
+}
+
 func serverCommand() *cli.Command {
 	cmd := apiServerCommand{}
 
@@ -98,16 +148,49 @@ func serverCommand() *cli.Command {
 		},
 		&cli.StringFlag{
 			Name:     "route53-zone-id",
-			Usage:    "AWS Route53 Zone ID where records will be created",
+			Usage:    "AWS Route53 Zone ID where records will be created, unless a domain is created in another zone",
 			EnvVars:  []string{"ACORN_ROUTE53_ZONE_ID"},
 			Required: true,
 		},
+		&cli.StringSliceFlag{
+			Name:    "route53-additional-zone-ids",
+			Usage:   "AWS Route53 Zone IDs of other zones domains can be created in, by the zone's name",
+			EnvVars: []string{"ACORN_ROUTE53_ADDITIONAL_ZONE_IDS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "route53-custom-domain-zone-ids",
+			Usage:   "AWS Route53 Zone IDs of zones that hold custom domains, which are created under names their creators own once they're verified",
+			EnvVars: []string{"ACORN_ROUTE53_CUSTOM_DOMAIN_ZONE_IDS"},
+		},
+		&cli.StringFlag{
+			Name:    "verification-resolver",
+			Usage:   "Address (host:port) of the DNS server used to look up custom domain verification challenges. Defaults to the system's resolver",
+			EnvVars: []string{"ACORN_VERIFICATION_RESOLVER"},
+		},
+		&cli.Int64Flag{
+			Name:    "custom-domain-verification-max-age-seconds",
+			Usage:   "How long a custom domain can wait to be verified before it has to be registered again. Default 86,400 (1 day)",
+			EnvVars: []string{"ACORN_CUSTOM_DOMAIN_VERIFICATION_MAX_AGE_SECONDS"},
+			Value:   86400,
+		},
 		&cli.Int64Flag{
 			Name:    "route53-record-ttl-seconds",
-			Usage:   "AWS Route53 record TTL",
+			Usage:   "AWS Route53 record TTL, used when a record request doesn't specify one",
 			EnvVars: []string{"ACORN_ROUTE53_RECORD_TTL_SECONDS"},
 			Value:   300,
 		},
+		&cli.Int64Flag{
+			Name:    "record-min-ttl-seconds",
+			Usage:   "Minimum TTL a record request can specify",
+			EnvVars: []string{"ACORN_RECORD_MIN_TTL_SECONDS"},
+			Value:   30,
+		},
+		&cli.Int64Flag{
+			Name:    "record-max-ttl-seconds",
+			Usage:   "Maximum TTL a record request can specify. Default 86,400 (1 day)",
+			EnvVars: []string{"ACORN_RECORD_MAX_TTL_SECONDS"},
+			Value:   86400,
+		},
 		&cli.Int64Flag{
 			Name:    "purge-interval-seconds",
 			Usage:   "How often to run the domain and record purge daemon. Default 86,400 (1 day)",
@@ -116,16 +199,153 @@ func serverCommand() *cli.Command {
 		},
 		&cli.Int64Flag{
 			Name:    "domain-max-age-seconds",
-			Usage:   "Max age a domain can be without being renewed before it's deleted. Default 2,592,000 (30 days)",
+			Usage:   "Max age a domain can be without being renewed before it stops resolving and enters its grace period. Default 2,592,000 (30 days)",
 			EnvVars: []string{"ACORN_DOMAIN_MAX_AGE_SECONDS"},
 			Value:   2592000,
 		},
+		&cli.Int64Flag{
+			Name:    "domain-grace-period-seconds",
+			Usage:   "How long a domain that has reached its max age stops resolving but can still be reclaimed by renewing it, before it's deleted. Reclaiming a domain only restores the records that haven't been purged for reaching their own max age. Default 604,800 (7 days)",
+			EnvVars: []string{"ACORN_DOMAIN_GRACE_PERIOD_SECONDS"},
+			Value:   604800,
+		},
+		&cli.Int64Flag{
+			Name:    "deleted-domain-retention-seconds",
+			Usage:   "How long a purged domain can be restored through the admin API before it's deleted for good, which frees its slug. Default 2,592,000 (30 days)",
+			EnvVars: []string{"ACORN_DELETED_DOMAIN_RETENTION_SECONDS"},
+			Value:   2592000,
+		},
+		&cli.Int64Flag{
+			Name:    "audit-log-max-age-seconds",
+			Usage:   "How long entries are kept in the audit log of changes to domains and records. Default 7,776,000 (90 days)",
+			EnvVars: []string{"ACORN_AUDIT_LOG_MAX_AGE_SECONDS"},
+			Value:   7776000,
+		},
 		&cli.Int64Flag{
 			Name:    "record-max-age-seconds",
 			Usage:   "Max age a domain can be without being renewed before it's deleted. Default 172,800 (2 days)",
 			EnvVars: []string{"ACORN_RECORD_MAX_AGE_SECONDS"},
 			Value:   172800,
 		},
+		&cli.Int64Flag{
+			Name:    "acme-challenge-max-age-seconds",
+			Usage:   "How long an ACME challenge value is kept before it's removed automatically. Default 600 (10 minutes)",
+			EnvVars: []string{"ACORN_ACME_CHALLENGE_MAX_AGE_SECONDS"},
+			Value:   600,
+		},
+		&cli.Int64Flag{
+			Name:    "idempotency-key-max-age-seconds",
+			Usage:   "How long the response to a request with an Idempotency-Key header is kept for replaying. Default 86,400 (1 day)",
+			EnvVars: []string{"ACORN_IDEMPOTENCY_KEY_MAX_AGE_SECONDS"},
+			Value:   86400,
+		},
+		&cli.Int64Flag{
+			Name:    "domain-creation-ip-rate-per-hour",
+			Usage:   "How many domains a single IP can create per hour. 0 disables the limit",
+			EnvVars: []string{"ACORN_DOMAIN_CREATION_IP_RATE_PER_HOUR"},
+			Value:   10,
+		},
+		&cli.Int64Flag{
+			Name:    "domain-creation-ip-burst",
+			Usage:   "How many domains a single IP can create at once before its hourly rate applies",
+			EnvVars: []string{"ACORN_DOMAIN_CREATION_IP_BURST"},
+			Value:   5,
+		},
+		&cli.Int64Flag{
+			Name:    "domain-creation-global-rate-per-hour",
+			Usage:   "How many domains can be created per hour in total. 0 disables the limit",
+			EnvVars: []string{"ACORN_DOMAIN_CREATION_GLOBAL_RATE_PER_HOUR"},
+			Value:   1000,
+		},
+		&cli.Int64Flag{
+			Name:    "domain-creation-global-burst",
+			Usage:   "How many domains can be created at once in total before the hourly rate applies",
+			EnvVars: []string{"ACORN_DOMAIN_CREATION_GLOBAL_BURST"},
+			Value:   100,
+		},
+		&cli.StringFlag{
+			Name:    "registration-secret",
+			Usage:   "If set, creating a domain requires this secret in the X-Registration-Secret header",
+			EnvVars: []string{"ACORN_REGISTRATION_SECRET"},
+		},
+		&cli.IntFlag{
+			Name:    "proof-of-work-bits",
+			Usage:   "If set, creating a domain requires a proof of work in the X-Proof-Of-Work header with this many leading zero bits",
+			EnvVars: []string{"ACORN_PROOF_OF_WORK_BITS"},
+		},
+		&cli.Int64Flag{
+			Name:    "max-records-per-domain",
+			Usage:   "Default quota of records a domain can have. 0 means no limit",
+			EnvVars: []string{"ACORN_MAX_RECORDS_PER_DOMAIN"},
+			Value:   1000,
+		},
+		&cli.Int64Flag{
+			Name:    "max-values-per-record",
+			Usage:   "Default quota of values a domain's records can have. 0 means no limit",
+			EnvVars: []string{"ACORN_MAX_VALUES_PER_RECORD"},
+			Value:   100,
+		},
+		&cli.Int64Flag{
+			Name:    "max-record-mutations-per-minute",
+			Usage:   "Default quota of requests per minute that change a domain's records. 0 means no limit",
+			EnvVars: []string{"ACORN_MAX_RECORD_MUTATIONS_PER_MINUTE"},
+			Value:   60,
+		},
+		&cli.StringSliceFlag{
+			Name:    "denied-slugs",
+			Usage:   "Slugs that are never given to domains",
+			EnvVars: []string{"ACORN_DENIED_SLUGS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "denied-slug-patterns",
+			Usage:   "Regular expressions matching slugs that are never given to domains",
+			EnvVars: []string{"ACORN_DENIED_SLUG_PATTERNS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "denied-record-labels",
+			Usage:   "Labels that can't be used in record names",
+			EnvVars: []string{"ACORN_DENIED_RECORD_LABELS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "denied-record-label-patterns",
+			Usage:   "Regular expressions matching labels that can't be used in record names",
+			EnvVars: []string{"ACORN_DENIED_RECORD_LABEL_PATTERNS"},
+		},
+		&cli.BoolFlag{
+			Name:    "vanity-slugs",
+			Usage:   "Let anyone request the slug of the domains they create. Otherwise, requesting one requires an invitation code issued through the admin API",
+			EnvVars: []string{"ACORN_VANITY_SLUGS"},
+		},
+		&cli.BoolFlag{
+			Name:    "sub-zones",
+			Usage:   "Give each new domain its own AWS Route53 hosted zone, delegated to with NS records in the zone it's created in. The hosted zone is deleted when the domain is purged",
+			EnvVars: []string{"ACORN_SUB_ZONES"},
+		},
+		&cli.StringFlag{
+			Name:    "dnssec-kms-key-arn",
+			Usage:   "ARN of the AWS KMS key (ECC_NIST_P256, in us-east-1) AWS Route53 signs zones with. Signing is enabled per zone through the admin API. Only the served zones are signed, so signing can't be enabled along with --sub-zones",
+			EnvVars: []string{"ACORN_DNSSEC_KMS_KEY_ARN"},
+		},
+		&cli.BoolFlag{
+			Name:    "webhook-allow-private-addresses",
+			Usage:   "Let webhooks be delivered to loopback, private and link-local addresses",
+			EnvVars: []string{"ACORN_WEBHOOK_ALLOW_PRIVATE_ADDRESSES"},
+		},
+		&cli.StringFlag{
+			Name:    "admin-token",
+			Usage:   "Token operators authenticate to the admin API with. The admin API is disabled if it isn't set",
+			EnvVars: []string{"ACORN_ADMIN_TOKEN"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "trusted-proxies",
+			Usage:   "Addresses or CIDR ranges of the proxies in front of the server. Client addresses are only taken from the X-Forwarded-For header of requests that come through them",
+			EnvVars: []string{"ACORN_TRUSTED_PROXIES"},
+		},
+		&cli.BoolFlag{
+			Name:    "acme-dns-api",
+			Usage:   "Serve the acme-dns compatible /register and /update endpoints. Domains registered through them never expire",
+			EnvVars: []string{"ACORN_ACME_DNS_API"},
+		},
 		&cli.StringFlag{
 			Name:    "db-engine",
 			Usage:   "The type of DB to connect to, sqlite or mariadb",
@@ -1,17 +1,71 @@
 package db
 
 import (
+	"time"
+
 	"github.com/acorn-io/acorn-dns/pkg/model"
 )
 
 type Database interface {
-	CreateNewSubDomain(tokenHash, domainName string) (Domain, error)
+	CreateNewSubDomain(tokenHash, zone string, neverExpires bool, allowSlug func(string) bool) (Domain, error)
+	CreateSubDomainWithSlug(tokenHash, zone, slug, invitationCodeHash string) (Domain, error)
+	IsSlugTaken(slug string) (bool, error)
 	GetDomain(domain string) (Domain, error)
-	PersistRecord(domainID uint, fqdn, rType string, values []string) error
+	GetDomainByID(domainID uint) (Domain, error)
+	DeleteDomain(domainID uint) error
+	GetDeletedDomain(domainName string) (Domain, error)
+	RestoreDomain(domainID uint) error
+	SetDomainSubZone(domainID uint, subZoneID string) error
+	GetDomainsNotRenewedSince(t time.Time) ([]Domain, error)
+	SetDomainSuspended(domainID uint, suspendedAt *time.Time) error
+	GetDeletedSubZoneDomains() ([]Domain, error)
+	SetDomainQuotaOverride(domainID uint, override model.DomainQuotaOverride) error
+	CountDomainRecords(domainID uint) (int64, error)
+	PersistRecord(record Record, maxRecords int64) (Record, error)
+	PersistRecordIfUnchanged(record, current Record, maxRecords int64) (Record, error)
 	Renew(domainID uint, fqdnTypePairs []model.FQDNTypePair, version string) error
 	GetDomainRecords(domainID uint) (map[model.FQDNTypePair]Record, error)
 	GetDomainRecordsByFQDN(fqdn string, domainID uint) ([]Record, error)
 	DeleteRecords(records []Record) error
-	PurgeOldDomainsAndRecords(maxDomainAgeSeconds, maxRecordAgeSeconds int64) (int64, int64, error)
+	ApplyRecordBatch(persist []Record, remove []Record, maxRecords int64) error
+	GetRecordsWithExpiredValues() ([]Record, error)
+	PurgeOldDomainsAndRecords(maxDomainAgeSeconds, maxRecordAgeSeconds int64) ([]Domain, []Record, error)
+	PurgeDeletedDomains(retentionSeconds int64) ([]Domain, error)
+	CreateHealthCheck(healthCheck HealthCheck) (HealthCheck, error)
+	GetHealthCheck(domainID uint, providerID string) (HealthCheck, error)
+	GetHealthChecks(domainID uint) ([]HealthCheck, error)
+	GetRecordsHealthChecks(records []Record) ([]HealthCheck, error)
+	GetOrphanedHealthChecks() ([]HealthCheck, error)
+	GetHealthCheckRecords(providerID string) ([]Record, error)
+	DeleteHealthChecks(healthChecks []HealthCheck) error
+	CreateIdempotencyKey(key IdempotencyKey, maxAgeSeconds int64) (IdempotencyKey, bool, error)
+	SaveIdempotencyKey(key IdempotencyKey) error
+	DeleteIdempotencyKey(key IdempotencyKey) error
+	PurgeOldIdempotencyKeys(maxAgeSeconds int64) (int64, error)
+	CreateAuditEntry(entry AuditEntry) error
+	GetAuditEntries(domainID uint, domainName string, beforeID uint, limit int) ([]AuditEntry, error)
+	PurgeOldAuditEntries(maxAgeSeconds int64) (int64, error)
+	TakeRateLimitToken(key string, rate, burst float64) (bool, time.Duration, error)
+	PeekRateLimitTokens(key string, rate, burst float64) (float64, error)
+	PurgeOldRateLimitBuckets(maxAgeSeconds int64) (int64, error)
+	CreateNameRule(rule NameRule) (NameRule, error)
+	GetNameRules() ([]NameRule, error)
+	DeleteNameRule(id uint) (bool, error)
+	CreateInvitation(invitation Invitation) (Invitation, error)
+	GetInvitations() ([]Invitation, error)
+	GetInvitationByCodeHash(codeHash string) (Invitation, error)
+	DeleteInvitation(id uint) (bool, error)
+	CreateCustomDomainVerification(verification CustomDomainVerification, maxAgeSeconds int64) (CustomDomainVerification, error)
+	GetCustomDomainVerification(name string) (CustomDomainVerification, error)
+	CompleteCustomDomainVerification(verification CustomDomainVerification) (Domain, error)
+	PurgeOldCustomDomainVerifications(maxAgeSeconds int64) (int64, error)
+	CreateWebhookSubscription(subscription WebhookSubscription) (WebhookSubscription, error)
+	GetWebhookSubscriptions(domainID uint) ([]WebhookSubscription, error)
+	DeleteWebhookSubscription(domainID uint, id uint) (bool, error)
+	EnqueueWebhookDeliveries(domainID uint, event string, payload []byte) error
+	ClaimWebhookDeliveries(limit int, lease time.Duration) ([]WebhookDelivery, map[uint]WebhookSubscription, error)
+	RescheduleWebhookDelivery(delivery WebhookDelivery) error
+	DeleteWebhookDelivery(delivery WebhookDelivery) error
+	PurgeDeletedDomainsWebhookSubscriptions() (int64, error)
 	GetYoungRecords(maxAgeSeconds int64, fqdnTypePairs map[model.FQDNTypePair]bool) (map[model.FQDNTypePair]Record, error)
 }
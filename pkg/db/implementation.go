@@ -2,18 +2,24 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"sort"
+	"math"
 	"strings"
 	"time"
 
 	"github.com/acorn-io/acorn-dns/pkg/model"
 	"github.com/acorn-io/acorn-dns/pkg/rand"
+	sqlitedriver "github.com/glebarez/go-sqlite"
 	"github.com/glebarez/sqlite"
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 const (
@@ -54,41 +60,74 @@ func New(ctx context.Context, engine string, dsn string, config *gorm.Config) (D
 	if err := db.AutoMigrate(
 		&Domain{},
 		&Record{},
+		&RecordValue{},
+		&HealthCheck{},
+		&IdempotencyKey{},
+		&RateLimitBucket{},
+		&NameRule{},
+		&Invitation{},
+		&CustomDomainVerification{},
+		&WebhookSubscription{},
+		&WebhookDelivery{},
+		&AuditEntry{},
 	); err != nil {
 		return nil, err
 	}
 
+	if err := migrateLegacyValues(db); err != nil {
+		return nil, err
+	}
+
+	if err := dropLegacyRecordIndex(db); err != nil {
+		return nil, err
+	}
+
+	if err := migrateDomainZones(db); err != nil {
+		return nil, err
+	}
+
+	if err := dropDomainCreationResponses(db); err != nil {
+		return nil, err
+	}
+
 	d := &database{
 		db: db,
 	}
 	return d, nil
 }
 
-func (d *database) CreateNewSubDomain(tokenHash, domainName string) (Domain, error) {
+// CreateNewSubDomain creates a domain in zone with a unique, randomly generated slug that allowSlug accepts
+func (d *database) CreateNewSubDomain(tokenHash, zone string, neverExpires bool, allowSlug func(string) bool) (Domain, error) {
 	var domain Domain
 	err := d.db.Transaction(func(tx *gorm.DB) error {
 		var slug string
 		for i := 0; i < maxSlugHashTimes; i++ {
 			s := rand.StringWithSmall(slugLength)
-			sql := tx.Where("unique_slug = ?", s).Take(&Domain{})
-			if sql.Error != nil {
-				if sql.Error == gorm.ErrRecordNotFound {
-					slug = s
-					break
-				}
-				logrus.Warnf("Error while finding unique slug: %v", sql.Error)
+			if !allowSlug(s) {
+				continue
+			}
+			inUse, err := slugInUse(tx, s)
+			if err != nil {
+				logrus.Warnf("Error while finding unique slug: %v", err)
+				continue
+			}
+			if !inUse {
+				slug = s
+				break
 			}
 		}
 		if slug == "" {
 			return fmt.Errorf("couldn't generate slug")
 		}
-		subDomain := fmt.Sprintf(".%s.%s", slug, domainName)
+		subDomain := fmt.Sprintf(".%s.%s", slug, zone)
 
 		domain = Domain{
-			TokenHash:   tokenHash,
-			UniqueSlug:  slug,
-			Domain:      subDomain,
-			LastCheckIn: time.Now(),
+			TokenHash:    tokenHash,
+			UniqueSlug:   slug,
+			Domain:       subDomain,
+			Zone:         zone,
+			LastCheckIn:  time.Now(),
+			NeverExpires: neverExpires,
 		}
 
 		sql := tx.Create(&domain)
@@ -102,29 +141,192 @@ func (d *database) CreateNewSubDomain(tokenHash, domainName string) (Domain, err
 	return domain, err
 }
 
+// These errors are returned by CreateSubDomainWithSlug
+var (
+	ErrSlugTaken         = errors.New("slug is taken")
+	ErrInvalidInvitation = errors.New("invitation code is invalid or used up")
+)
+
+// CreateSubDomainWithSlug creates a domain in zone with the given slug. If invitationCodeHash is set, one use of the invitation
+// with that code is consumed, which fails if it has none left.
+func (d *database) CreateSubDomainWithSlug(tokenHash, zone, slug, invitationCodeHash string) (Domain, error) {
+	var domain Domain
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if invitationCodeHash != "" {
+			sql := tx.Model(&Invitation{}).Where("code_hash = ? and remaining_uses > 0", invitationCodeHash).
+				Update("remaining_uses", gorm.Expr("remaining_uses - 1"))
+			if sql.Error != nil {
+				return sql.Error
+			}
+			if sql.RowsAffected == 0 {
+				return ErrInvalidInvitation
+			}
+		}
+
+		inUse, err := slugInUse(tx, slug)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			return ErrSlugTaken
+		}
+
+		domain = Domain{
+			TokenHash:   tokenHash,
+			UniqueSlug:  slug,
+			Domain:      fmt.Sprintf(".%s.%s", slug, zone),
+			Zone:        zone,
+			LastCheckIn: time.Now(),
+		}
+		return tx.Create(&domain).Error
+	})
+	if isUniqueViolation(err) {
+		// Another request created a domain with the slug after it was checked
+		return Domain{}, ErrSlugTaken
+	}
+
+	return domain, err
+}
+
+// isUniqueViolation reports whether the database rejected a row because it would have duplicated a unique index
+func isUniqueViolation(err error) bool {
+	var mysqlErr *mysqldriver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		// ER_DUP_ENTRY
+		return mysqlErr.Number == 1062
+	}
+	var sqliteErr *sqlitedriver.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY)
+}
+
+// IsSlugTaken reports whether a domain, including a deleted one, has the slug
+func (d *database) IsSlugTaken(slug string) (bool, error) {
+	return slugInUse(d.db, slug)
+}
+
+// slugInUse reports whether the slug can't be given to a new domain. Deleted domains still hold their slugs, which are
+// unique across all domains, until they're purged for good.
+func slugInUse(tx *gorm.DB, slug string) (bool, error) {
+	var count int64
+	sql := tx.Unscoped().Model(&Domain{}).Where("unique_slug = ?", slug).Count(&count)
+	return count > 0, sql.Error
+}
+
 func (d *database) GetDomain(domainName string) (Domain, error) {
 	domain := Domain{}
 	sql := d.db.Where("domain = ?", domainName).Limit(1).Find(&domain)
 	return domain, sql.Error
 }
 
+// GetDomainByID returns the domain with the given ID. Deleted domains are included, since their records may still need
+// to be cleaned up.
+func (d *database) GetDomainByID(domainID uint) (Domain, error) {
+	domain := Domain{}
+	sql := d.db.Unscoped().Where("id = ?", domainID).Limit(1).Find(&domain)
+	return domain, sql.Error
+}
+
+// DeleteDomain deletes the domain with the given ID. Like purged domains, it is only soft deleted, so its slug stays taken
+// until PurgeDeletedDomains deletes it for good.
+func (d *database) DeleteDomain(domainID uint) error {
+	return d.db.Delete(&Domain{}, domainID).Error
+}
+
+// GetDeletedDomain returns the deleted domain with the given name. Its ID is 0 if there is none.
+func (d *database) GetDeletedDomain(domainName string) (Domain, error) {
+	domain := Domain{}
+	sql := d.db.Unscoped().Where("domain = ? and deleted_at is not null", domainName).Limit(1).Find(&domain)
+	return domain, sql.Error
+}
+
+// ErrDomainTaken is returned by RestoreDomain when another domain now has the deleted domain's slug or name
+var ErrDomainTaken = errors.New("slug or name is taken by another domain")
+
+// RestoreDomain undeletes the domain and renews it, so that it isn't purged again right away
+func (d *database) RestoreDomain(domainID uint) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		var domain Domain
+		if sql := tx.Unscoped().Where("id = ?", domainID).Take(&domain); sql.Error != nil {
+			return sql.Error
+		}
+
+		var count int64
+		sql := tx.Model(&Domain{}).Where("id <> ? and (unique_slug = ? or domain = ?)", domainID, domain.UniqueSlug, domain.Domain).
+			Count(&count)
+		if sql.Error != nil {
+			return sql.Error
+		}
+		if count > 0 {
+			return ErrDomainTaken
+		}
+
+		return tx.Unscoped().Model(&Domain{Model: gorm.Model{ID: domainID}}).
+			Updates(map[string]interface{}{"deleted_at": nil, "last_check_in": time.Now()}).Error
+	})
+}
+
+// SetDomainSubZone sets the ID of the domain's own hosted zone, or clears it if subZoneID is empty
+func (d *database) SetDomainSubZone(domainID uint, subZoneID string) error {
+	return d.db.Unscoped().Model(&Domain{Model: gorm.Model{ID: domainID}}).Update("sub_zone_id", subZoneID).Error
+}
+
+// GetDomainsNotRenewedSince returns the domains that were last renewed before the given time, leaving out the ones that
+// never expire
+func (d *database) GetDomainsNotRenewedSince(t time.Time) ([]Domain, error) {
+	var domains []Domain
+	sql := d.db.Where("last_check_in < ? and never_expires = ?", t, false).Find(&domains)
+	return domains, sql.Error
+}
+
+// SetDomainSuspended sets when the domain was suspended, or clears it if suspendedAt is nil
+func (d *database) SetDomainSuspended(domainID uint, suspendedAt *time.Time) error {
+	return d.db.Model(&Domain{Model: gorm.Model{ID: domainID}}).Update("suspended_at", suspendedAt).Error
+}
+
+// GetDeletedSubZoneDomains returns the deleted domains whose own hosted zone hasn't been torn down yet
+func (d *database) GetDeletedSubZoneDomains() ([]Domain, error) {
+	var domains []Domain
+	sql := d.db.Unscoped().Where("deleted_at is not null and sub_zone_id <> ?", "").Find(&domains)
+	return domains, sql.Error
+}
+
+// SetDomainQuotaOverride replaces the domain's quota overrides. Limits that aren't set in override are cleared.
+func (d *database) SetDomainQuotaOverride(domainID uint, override model.DomainQuotaOverride) error {
+	sql := d.db.Model(&Domain{Model: gorm.Model{ID: domainID}}).Updates(map[string]interface{}{
+		"max_records":              override.MaxRecords,
+		"max_values_per_record":    override.MaxValuesPerRecord,
+		"max_mutations_per_minute": override.MaxMutationsPerMinute,
+	})
+	return sql.Error
+}
+
+func (d *database) CountDomainRecords(domainID uint) (int64, error) {
+	var count int64
+	sql := d.db.Model(&Record{}).Where("domain_id = ?", domainID).Count(&count)
+	return count, sql.Error
+}
+
 func (d *database) Renew(domainID uint, fqdnTypePairs []model.FQDNTypePair, version string) error {
 
 	return d.db.Transaction(func(tx *gorm.DB) error {
 		now := time.Now()
 
-		// producing separate update queries by type that will look like:
-		// update ... where type = 'A' and fqdn in (...) ...
-		// update ... where type = 'TXT' and fqdn in (...) ...
-		fqdnsByType := make(map[string][]string)
+		// producing separate update queries by type and set identifier that will look like:
+		// update ... where type = 'A' and set_identifier = '' and fqdn in (...) ...
+		// update ... where type = 'TXT' and set_identifier = '' and fqdn in (...) ...
+		type typeSet struct {
+			rType, setIdentifier string
+		}
+		fqdnsByType := make(map[typeSet][]string)
 		for _, pair := range fqdnTypePairs {
-			fqdns := fqdnsByType[pair.Type]
-			fqdns = append(fqdns, pair.FQDN)
-			fqdnsByType[pair.Type] = fqdns
+			key := typeSet{rType: pair.Type, setIdentifier: pair.SetIdentifier}
+			fqdnsByType[key] = append(fqdnsByType[key], pair.FQDN)
 		}
 
 		for t, fqdns := range fqdnsByType {
-			sql := tx.Model(&Record{}).Where("type = ? and fqdn IN ? and domain_id = ?", t, fqdns, domainID).
+			sql := tx.Model(&Record{}).
+				Where("type = ? and set_identifier = ? and fqdn IN ? and domain_id = ?", t.rType, t.setIdentifier, fqdns, domainID).
 				Update("last_check_in", now)
 			if sql.Error != nil {
 				return sql.Error
@@ -141,58 +343,233 @@ func (d *database) Renew(domainID uint, fqdnTypePairs []model.FQDNTypePair, vers
 	})
 }
 
-func (d *database) PurgeOldDomainsAndRecords(domainMaxAgeSeconds, recordMaxAgeSeconds int64) (int64, int64, error) {
-	var domainsDeleted, recordsDeleted int64
+// PurgeOldDomainsAndRecords deletes the domains and records that haven't been renewed within their max ages and returns
+// what was deleted
+func (d *database) PurgeOldDomainsAndRecords(domainMaxAgeSeconds, recordMaxAgeSeconds int64) ([]Domain, []Record, error) {
+	var (
+		domains []Domain
+		records []Record
+	)
 	err := d.db.Transaction(func(tx *gorm.DB) error {
 		lastCheckInDomain := time.Now().Add(-time.Second * time.Duration(domainMaxAgeSeconds))
 		lastCheckInRecord := time.Now().Add(-time.Second * time.Duration(recordMaxAgeSeconds))
-		sql := d.db.Where("last_check_in < ?", lastCheckInDomain).Delete(&Domain{})
+
+		// Domains are only soft deleted, so that they can be restored until PurgeDeletedDomains deletes them for good
+		sql := tx.Where("last_check_in < ? and never_expires = ?", lastCheckInDomain, false).Find(&domains)
 		if sql.Error != nil {
 			return sql.Error
 		}
-		domainsDeleted = sql.RowsAffected
+		if len(domains) > 0 {
+			ids := make([]uint, 0, len(domains))
+			for _, domain := range domains {
+				ids = append(ids, domain.ID)
+			}
+			if sql := tx.Delete(&Domain{}, ids); sql.Error != nil {
+				return sql.Error
+			}
+		}
 
-		// domains is a soft delete, so the RowsAffected is accurate. We don't get that for the records' hard delete.
-		// Need to get a count first
-		sql = d.db.Model(&Record{}).Where("last_check_in < ?", lastCheckInRecord).Count(&recordsDeleted)
+		sql = tx.Where("last_check_in < ?", lastCheckInRecord).Find(&records)
+		if sql.Error != nil {
+			return sql.Error
+		}
+		sql = tx.Where("record_id IN (?)", tx.Model(&Record{}).Select("id").Where("last_check_in < ?", lastCheckInRecord)).
+			Delete(&RecordValue{})
 		if sql.Error != nil {
 			return sql.Error
 		}
-		sql = d.db.Where("last_check_in < ?", lastCheckInRecord).Delete(&Record{})
+		sql = tx.Where("last_check_in < ?", lastCheckInRecord).Delete(&Record{})
 		return sql.Error
 	})
 
-	return domainsDeleted, recordsDeleted, err
+	return domains, records, err
+}
+
+// PurgeDeletedDomains permanently deletes the domains that were deleted more than retentionSeconds ago, along with
+// whatever still belongs to them, and returns them. This frees their slugs. Domains whose own hosted zone hasn't been torn
+// down yet are kept until it is, since the zone's ID would be lost with them.
+func (d *database) PurgeDeletedDomains(retentionSeconds int64) ([]Domain, error) {
+	var domains []Domain
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		deletedBefore := time.Now().Add(-time.Second * time.Duration(retentionSeconds))
+		if sql := tx.Unscoped().Where("deleted_at < ? and sub_zone_id = ?", deletedBefore, "").Find(&domains); sql.Error != nil {
+			return sql.Error
+		}
+		if len(domains) == 0 {
+			return nil
+		}
+
+		domainIDs := make([]uint, 0, len(domains))
+		for _, domain := range domains {
+			domainIDs = append(domainIDs, domain.ID)
+		}
+		recordIDs := tx.Model(&Record{}).Select("id").Where("domain_id IN (?)", domainIDs)
+		subscriptionIDs := tx.Model(&WebhookSubscription{}).Select("id").Where("domain_id IN (?)", domainIDs)
+
+		if sql := tx.Where("record_id IN (?)", recordIDs).Delete(&RecordValue{}); sql.Error != nil {
+			return sql.Error
+		}
+		if sql := tx.Where("domain_id IN (?)", domainIDs).Delete(&Record{}); sql.Error != nil {
+			return sql.Error
+		}
+		if sql := tx.Where("subscription_id IN (?)", subscriptionIDs).Delete(&WebhookDelivery{}); sql.Error != nil {
+			return sql.Error
+		}
+		if sql := tx.Where("domain_id IN (?)", domainIDs).Delete(&WebhookSubscription{}); sql.Error != nil {
+			return sql.Error
+		}
+		return tx.Unscoped().Where("id IN (?)", domainIDs).Delete(&Domain{}).Error
+	})
+	return domains, err
+}
+
+// PersistRecord creates or updates the record with the given record's FQDN, type and set identifier. For an existing
+// record, the values and everything describing the record set are replaced with those of the given record. The record
+// is returned as persisted. Unless maxRecords is 0, nothing is persisted and ErrTooManyRecords is returned if the
+// domain would have more records than that.
+func (d *database) PersistRecord(record Record, maxRecords int64) (Record, error) {
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		record, err = persistRecord(tx, record)
+		if err != nil {
+			return err
+		}
+		return checkRecordLimit(tx, record.DomainID, maxRecords)
+	})
+	return record, err
 }
 
-func DenormalizeValues(values []string) string {
-	sort.Strings(values)
-	return strings.Join(values, ",")
+var (
+	// ErrRevisionChanged is returned by PersistRecordIfUnchanged when the record was changed after it was read
+	ErrRevisionChanged = errors.New("record was changed concurrently")
+	// ErrTooManyRecords is returned when persisting records would leave their domain with more than the allowed number
+	ErrTooManyRecords = errors.New("domain has too many records")
+)
+
+// PersistRecordIfUnchanged is PersistRecord for a change that was checked against current, the record as it was read,
+// which has no ID if it didn't exist. Nothing is persisted and ErrRevisionChanged is returned if the record has changed
+// since.
+func (d *database) PersistRecordIfUnchanged(record, current Record, maxRecords int64) (Record, error) {
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		var r Record
+		sql := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("fqdn = ? and type = ? and set_identifier = ?", record.FQDN, record.Type, record.SetIdentifier).
+			Limit(1).Find(&r)
+		if sql.Error != nil {
+			return sql.Error
+		}
+		if r.ID != current.ID || r.Revision != current.Revision {
+			return ErrRevisionChanged
+		}
+
+		var err error
+		record, err = persistRecord(tx, record)
+		if err != nil {
+			return err
+		}
+		return checkRecordLimit(tx, record.DomainID, maxRecords)
+	})
+	return record, err
+}
+
+// ApplyRecordBatch persists and deletes records in a single transaction, so that either all or none of the changes are
+// made. Like PersistRecord, it fails with ErrTooManyRecords if the domain would have more than maxRecords records.
+func (d *database) ApplyRecordBatch(persist []Record, remove []Record, maxRecords int64) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if err := deleteRecords(tx, remove); err != nil {
+			return err
+		}
+		for _, record := range persist {
+			if _, err := persistRecord(tx, record); err != nil {
+				return err
+			}
+		}
+		if len(persist) == 0 {
+			return nil
+		}
+		return checkRecordLimit(tx, persist[0].DomainID, maxRecords)
+	})
+}
+
+// checkRecordLimit fails with ErrTooManyRecords if the domain has more than maxRecords records, unless maxRecords is 0.
+// It's called after the records were persisted, which bumped the domain's revision and so holds the lock on its row
+// until the transaction ends. The count is a locking read as well, so it includes the records of every transaction that
+// persisted records before this one.
+func checkRecordLimit(tx *gorm.DB, domainID uint, maxRecords int64) error {
+	if maxRecords == 0 {
+		return nil
+	}
+
+	var count int64
+	sql := tx.Model(&Record{}).Clauses(clause.Locking{Strength: "UPDATE"}).Where("domain_id = ?", domainID).Count(&count)
+	if sql.Error != nil {
+		return sql.Error
+	}
+	if count > maxRecords {
+		return ErrTooManyRecords
+	}
+	return nil
 }
 
-func (d *database) PersistRecord(domainID uint, fqdn, rType string, values []string) error {
-	r, err := d.getRecord(fqdn, rType)
+func persistRecord(tx *gorm.DB, record Record) (Record, error) {
+	r, err := getRecord(tx, record.FQDN, record.Type, record.SetIdentifier)
+	if err != nil {
+		return Record{}, err
+	}
+
+	revision, err := nextRevision(tx, record.DomainID)
 	if err != nil {
-		return err
+		return Record{}, err
 	}
 
-	denormalizeValues := DenormalizeValues(values)
+	// The values may have been loaded from another record, so they are always inserted as new rows
+	recordValues := make([]RecordValue, 0, len(record.Values))
+	for _, v := range record.Values {
+		v.ID = 0
+		v.RecordID = r.ID
+		recordValues = append(recordValues, v)
+	}
 
 	if r.ID == 0 {
-		newRecord := &Record{
-			FQDN:        fqdn,
-			Type:        rType,
-			DomainID:    domainID,
-			Values:      denormalizeValues,
-			LastCheckIn: time.Now(),
+		record.ID = 0
+		record.Values = recordValues
+		record.LastCheckIn = time.Now()
+		record.Revision = revision
+		sql := tx.Create(&record)
+		return record, sql.Error
+	}
+
+	// The values are replaced wholesale, mirroring the UPSERT of the record set in the provider
+	sql := tx.Where("record_id = ?", r.ID).Delete(&RecordValue{})
+	if sql.Error != nil {
+		return Record{}, sql.Error
+	}
+	if len(recordValues) > 0 {
+		if sql := tx.Create(&recordValues); sql.Error != nil {
+			return Record{}, sql.Error
 		}
-		sql := d.db.Create(newRecord)
-		return sql.Error
 	}
 
+	r.TTL = record.TTL
+	r.Alias = record.Alias
+	r.SetRouting(record.Routing())
 	r.LastCheckIn = time.Now()
-	sql := d.db.Save(r)
-	return sql.Error
+	r.Revision = revision
+	sql = tx.Omit("Values").Save(&r)
+	r.Values = recordValues
+	return r, sql.Error
+}
+
+// nextRevision increments the domain's revision and returns the new one
+func nextRevision(tx *gorm.DB, domainID uint) (int64, error) {
+	sql := tx.Model(&Domain{}).Where("id = ?", domainID).Update("revision", gorm.Expr("revision + 1"))
+	if sql.Error != nil {
+		return 0, sql.Error
+	}
+
+	var revision int64
+	sql = tx.Model(&Domain{}).Select("revision").Where("id = ?", domainID).Scan(&revision)
+	return revision, sql.Error
 }
 
 func (d *database) GetYoungRecords(maxAgeSeconds int64, fqdnTypePairs map[model.FQDNTypePair]bool) (map[model.FQDNTypePair]Record, error) {
@@ -209,7 +586,7 @@ func (d *database) GetYoungRecords(maxAgeSeconds int64, fqdnTypePairs map[model.
 
 	recordMap := make(map[model.FQDNTypePair]Record)
 	for _, r := range records {
-		pair := model.FQDNTypePair{FQDN: r.FQDN, Type: r.Type}
+		pair := r.Pair()
 		if _, ok := fqdnTypePairs[pair]; ok {
 			recordMap[pair] = r
 		}
@@ -219,15 +596,14 @@ func (d *database) GetYoungRecords(maxAgeSeconds int64, fqdnTypePairs map[model.
 
 func (d *database) GetDomainRecords(domainID uint) (map[model.FQDNTypePair]Record, error) {
 	var records []Record
-	sql := d.db.Model(&Record{}).Where("domain_id = ?", domainID).Find(&records)
+	sql := d.db.Model(&Record{}).Preload("Values").Where("domain_id = ?", domainID).Find(&records)
 	if sql.Error != nil {
 		return nil, sql.Error
 	}
 
 	recordMap := make(map[model.FQDNTypePair]Record)
 	for _, r := range records {
-		pair := model.FQDNTypePair{FQDN: r.FQDN, Type: r.Type}
-		recordMap[pair] = r
+		recordMap[r.Pair()] = r
 	}
 
 	return recordMap, nil
@@ -235,7 +611,7 @@ func (d *database) GetDomainRecords(domainID uint) (map[model.FQDNTypePair]Recor
 
 func (d *database) GetDomainRecordsByFQDN(fqdn string, domainID uint) ([]Record, error) {
 	var records []Record
-	sql := d.db.Where("fqdn = ? and domain_id = ?", fqdn, domainID).Find(&records)
+	sql := d.db.Preload("Values").Where("fqdn = ? and domain_id = ?", fqdn, domainID).Find(&records)
 	if sql.Error != nil {
 		return records, sql.Error
 	}
@@ -244,16 +620,525 @@ func (d *database) GetDomainRecordsByFQDN(fqdn string, domainID uint) ([]Record,
 }
 
 func (d *database) DeleteRecords(records []Record) error {
-	sql := d.db.Delete(&records)
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		return deleteRecords(tx, records)
+	})
+}
+
+func deleteRecords(tx *gorm.DB, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(records))
+	domainIDs := make(map[uint]bool)
+	for _, r := range records {
+		ids = append(ids, r.ID)
+		domainIDs[r.DomainID] = true
+	}
+
+	for domainID := range domainIDs {
+		if _, err := nextRevision(tx, domainID); err != nil {
+			return err
+		}
+	}
+
+	sql := tx.Where("record_id IN ?", ids).Delete(&RecordValue{})
+	if sql.Error != nil {
+		return sql.Error
+	}
+	sql = tx.Delete(&Record{}, ids)
 	return sql.Error
 }
 
-func (d *database) getRecord(fqdn, rType string) (Record, error) {
+// GetRecordsWithExpiredValues returns the records that have at least one value whose expiry has passed
+func (d *database) GetRecordsWithExpiredValues() ([]Record, error) {
+	var records []Record
+	sql := d.db.Preload("Values").
+		Where("id IN (?)", d.db.Model(&RecordValue{}).Select("record_id").Where("expires_at < ?", time.Now())).
+		Find(&records)
+	return records, sql.Error
+}
+
+func (d *database) CreateHealthCheck(healthCheck HealthCheck) (HealthCheck, error) {
+	sql := d.db.Create(&healthCheck)
+	return healthCheck, sql.Error
+}
+
+func (d *database) GetHealthCheck(domainID uint, providerID string) (HealthCheck, error) {
+	healthCheck := HealthCheck{}
+	sql := d.db.Where("domain_id = ? and provider_id = ?", domainID, providerID).Limit(1).Find(&healthCheck)
+	return healthCheck, sql.Error
+}
+
+func (d *database) GetHealthChecks(domainID uint) ([]HealthCheck, error) {
+	var healthChecks []HealthCheck
+	sql := d.db.Where("domain_id = ?", domainID).Order("id").Find(&healthChecks)
+	return healthChecks, sql.Error
+}
+
+func (d *database) GetRecordsHealthChecks(records []Record) ([]HealthCheck, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, 0, len(records))
+	for _, r := range records {
+		ids = append(ids, r.ID)
+	}
+
+	var healthChecks []HealthCheck
+	sql := d.db.Where("record_id IN ?", ids).Find(&healthChecks)
+	return healthChecks, sql.Error
+}
+
+// GetOrphanedHealthChecks returns the health checks whose record no longer exists, such as after the record was purged
+func (d *database) GetOrphanedHealthChecks() ([]HealthCheck, error) {
+	var healthChecks []HealthCheck
+	sql := d.db.Where("record_id NOT IN (?)", d.db.Model(&Record{}).Select("id")).Find(&healthChecks)
+	return healthChecks, sql.Error
+}
+
+// GetHealthCheckRecords returns the records whose routing policy refers to the health check with the given provider ID
+func (d *database) GetHealthCheckRecords(providerID string) ([]Record, error) {
+	var records []Record
+	sql := d.db.Where("health_check_id = ?", providerID).Order("id").Find(&records)
+	return records, sql.Error
+}
+
+func (d *database) DeleteHealthChecks(healthChecks []HealthCheck) error {
+	if len(healthChecks) == 0 {
+		return nil
+	}
+
+	sql := d.db.Delete(&healthChecks)
+	return sql.Error
+}
+
+// CreateIdempotencyKey stores a new key, unless one with the same scope and key exists that is younger than maxAgeSeconds.
+// It returns the stored key and whether it was created, or the existing key if it wasn't.
+func (d *database) CreateIdempotencyKey(key IdempotencyKey, maxAgeSeconds int64) (IdempotencyKey, bool, error) {
+	var created bool
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		// An expired key that hasn't been purged yet is as good as gone
+		expiry := time.Now().Add(-time.Second * time.Duration(maxAgeSeconds))
+		// key is a reserved word in MySQL, so let gorm quote the column names
+		match := IdempotencyKey{Scope: key.Scope, Key: key.Key}
+		sql := tx.Where(&match).Where("created_at < ?", expiry).Delete(&IdempotencyKey{})
+		if sql.Error != nil {
+			return sql.Error
+		}
+
+		sql = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&key)
+		if sql.Error != nil {
+			return sql.Error
+		}
+		if sql.RowsAffected > 0 {
+			created = true
+			return nil
+		}
+
+		key = IdempotencyKey{}
+		sql = tx.Where(&match).Limit(1).Find(&key)
+		return sql.Error
+	})
+	return key, created, err
+}
+
+func (d *database) SaveIdempotencyKey(key IdempotencyKey) error {
+	sql := d.db.Save(&key)
+	return sql.Error
+}
+
+func (d *database) DeleteIdempotencyKey(key IdempotencyKey) error {
+	sql := d.db.Delete(&key)
+	return sql.Error
+}
+
+func (d *database) PurgeOldIdempotencyKeys(maxAgeSeconds int64) (int64, error) {
+	expiry := time.Now().Add(-time.Second * time.Duration(maxAgeSeconds))
+	sql := d.db.Where("created_at < ?", expiry).Delete(&IdempotencyKey{})
+	return sql.RowsAffected, sql.Error
+}
+
+// TakeRateLimitToken takes a token from the bucket with the given key, which holds up to burst tokens and is refilled
+// at rate tokens per second. If the bucket is empty, it reports how long until the next token is available.
+func (d *database) TakeRateLimitToken(key string, rate, burst float64) (bool, time.Duration, error) {
+	var (
+		allowed    bool
+		retryAfter time.Duration
+	)
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// A new bucket starts out full
+		sql := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&RateLimitBucket{Key: key, Tokens: burst, RefilledAt: now})
+		if sql.Error != nil {
+			return sql.Error
+		}
+
+		var bucket RateLimitBucket
+		sql = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(&RateLimitBucket{Key: key}).Take(&bucket)
+		if sql.Error != nil {
+			return sql.Error
+		}
+
+		bucket.Tokens = math.Min(burst, bucket.Tokens+now.Sub(bucket.RefilledAt).Seconds()*rate)
+		bucket.RefilledAt = now
+		if bucket.Tokens >= 1 {
+			bucket.Tokens--
+			allowed = true
+		} else {
+			retryAfter = time.Duration((1 - bucket.Tokens) / rate * float64(time.Second))
+		}
+
+		sql = tx.Save(&bucket)
+		return sql.Error
+	})
+	return allowed, retryAfter, err
+}
+
+// PeekRateLimitTokens returns how many tokens the bucket with the given key holds, without taking any
+func (d *database) PeekRateLimitTokens(key string, rate, burst float64) (float64, error) {
+	var bucket RateLimitBucket
+	sql := d.db.Where(&RateLimitBucket{Key: key}).Limit(1).Find(&bucket)
+	if sql.Error != nil {
+		return 0, sql.Error
+	}
+	if bucket.Key == "" {
+		return burst, nil
+	}
+	return math.Min(burst, bucket.Tokens+time.Since(bucket.RefilledAt).Seconds()*rate), nil
+}
+
+// PurgeOldRateLimitBuckets deletes the buckets that haven't been used for maxAgeSeconds, which must be long enough for
+// them to have been refilled completely
+func (d *database) PurgeOldRateLimitBuckets(maxAgeSeconds int64) (int64, error) {
+	expiry := time.Now().Add(-time.Second * time.Duration(maxAgeSeconds))
+	sql := d.db.Where("refilled_at < ?", expiry).Delete(&RateLimitBucket{})
+	return sql.RowsAffected, sql.Error
+}
+
+func (d *database) CreateNameRule(rule NameRule) (NameRule, error) {
+	sql := d.db.Create(&rule)
+	return rule, sql.Error
+}
+
+func (d *database) GetNameRules() ([]NameRule, error) {
+	var rules []NameRule
+	sql := d.db.Order("id").Find(&rules)
+	return rules, sql.Error
+}
+
+// DeleteNameRule deletes the rule with the given ID and reports whether it existed
+func (d *database) DeleteNameRule(id uint) (bool, error) {
+	sql := d.db.Delete(&NameRule{}, id)
+	return sql.RowsAffected > 0, sql.Error
+}
+
+func (d *database) CreateInvitation(invitation Invitation) (Invitation, error) {
+	sql := d.db.Create(&invitation)
+	return invitation, sql.Error
+}
+
+func (d *database) GetInvitations() ([]Invitation, error) {
+	var invitations []Invitation
+	sql := d.db.Order("id").Find(&invitations)
+	return invitations, sql.Error
+}
+
+func (d *database) GetInvitationByCodeHash(codeHash string) (Invitation, error) {
+	invitation := Invitation{}
+	sql := d.db.Where("code_hash = ?", codeHash).Limit(1).Find(&invitation)
+	return invitation, sql.Error
+}
+
+// DeleteInvitation deletes the invitation with the given ID and reports whether it existed
+func (d *database) DeleteInvitation(id uint) (bool, error) {
+	sql := d.db.Delete(&Invitation{}, id)
+	return sql.RowsAffected > 0, sql.Error
+}
+
+func getRecord(tx *gorm.DB, fqdn, rType, setIdentifier string) (Record, error) {
 	record := Record{}
-	sql := d.db.Where("fqdn = ? and type = ?", fqdn, rType).Limit(1).Find(&record)
+	sql := tx.Where("fqdn = ? and type = ? and set_identifier = ?", fqdn, rType, setIdentifier).Limit(1).Find(&record)
 	if sql.Error != nil {
 		return record, sql.Error
 	}
 
 	return record, nil
 }
+
+// ErrNameTaken is returned when a custom domain's name is used by a domain, overlaps one, or is pending verification
+var ErrNameTaken = errors.New("name is taken")
+
+// CreateCustomDomainVerification starts the verification of a custom domain. A previous verification for the same name
+// that is older than maxAgeSeconds is replaced.
+func (d *database) CreateCustomDomainVerification(verification CustomDomainVerification, maxAgeSeconds int64) (CustomDomainVerification, error) {
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		inUse, err := domainNameInUse(tx, "."+verification.Name)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			return ErrNameTaken
+		}
+
+		expiry := time.Now().Add(-time.Second * time.Duration(maxAgeSeconds))
+		sql := tx.Where("name = ? and created_at < ?", verification.Name, expiry).Delete(&CustomDomainVerification{})
+		if sql.Error != nil {
+			return sql.Error
+		}
+
+		sql = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&verification)
+		if sql.Error != nil {
+			return sql.Error
+		}
+		if sql.RowsAffected == 0 {
+			return ErrNameTaken
+		}
+		return nil
+	})
+
+	return verification, err
+}
+
+func (d *database) GetCustomDomainVerification(name string) (CustomDomainVerification, error) {
+	verification := CustomDomainVerification{}
+	sql := d.db.Where("name = ?", name).Limit(1).Find(&verification)
+	return verification, sql.Error
+}
+
+// CompleteCustomDomainVerification creates the verified custom domain and removes its verification. The domain's slug is
+// its whole name, which can't collide with generated or requested slugs since those are single labels.
+func (d *database) CompleteCustomDomainVerification(verification CustomDomainVerification) (Domain, error) {
+	var domain Domain
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		sql := tx.Delete(&CustomDomainVerification{}, verification.ID)
+		if sql.Error != nil {
+			return sql.Error
+		}
+		if sql.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		domain = Domain{
+			TokenHash:   verification.TokenHash,
+			UniqueSlug:  verification.Name,
+			Domain:      "." + verification.Name,
+			Zone:        verification.Zone,
+			LastCheckIn: time.Now(),
+		}
+
+		inUse, err := domainNameInUse(tx, domain.Domain)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			return ErrNameTaken
+		}
+
+		return tx.Create(&domain).Error
+	})
+
+	return domain, err
+}
+
+func (d *database) PurgeOldCustomDomainVerifications(maxAgeSeconds int64) (int64, error) {
+	expiry := time.Now().Add(-time.Second * time.Duration(maxAgeSeconds))
+	sql := d.db.Where("created_at < ?", expiry).Delete(&CustomDomainVerification{})
+	return sql.RowsAffected, sql.Error
+}
+
+// likeEscaper escapes the characters that are special in the patterns of like, with ! as the escape character
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// domainNameInUse reports whether a domain, including a deleted one, has the given name or one above or below it, since
+// the records of either domain could then collide with the other's
+func domainNameInUse(tx *gorm.DB, domainName string) (bool, error) {
+	var parents []string
+	for name := domainName; ; {
+		i := strings.Index(name[1:], ".")
+		if i < 0 {
+			break
+		}
+		name = name[i+1:]
+		parents = append(parents, name)
+	}
+
+	// Names can hold underscores, which like would take as wildcards. ! is the escape character since, unlike a
+	// backslash, it means the same to every database.
+	escaped := likeEscaper.Replace(domainName)
+	query := tx.Unscoped().Model(&Domain{}).Where("domain = ? or domain like ? escape '!'", domainName, "%"+escaped)
+	if len(parents) > 0 {
+		query = query.Or("domain in ?", parents)
+	}
+
+	var count int64
+	sql := query.Count(&count)
+	return count > 0, sql.Error
+}
+
+func (d *database) CreateWebhookSubscription(subscription WebhookSubscription) (WebhookSubscription, error) {
+	sql := d.db.Create(&subscription)
+	return subscription, sql.Error
+}
+
+// GetWebhookSubscriptions returns the subscriptions of the domain with the given ID, or the global subscriptions if
+// domainID is 0
+func (d *database) GetWebhookSubscriptions(domainID uint) ([]WebhookSubscription, error) {
+	var subscriptions []WebhookSubscription
+	query := d.db.Order("id")
+	if domainID == 0 {
+		query = query.Where("domain_id is null")
+	} else {
+		query = query.Where("domain_id = ?", domainID)
+	}
+	sql := query.Find(&subscriptions)
+	return subscriptions, sql.Error
+}
+
+// DeleteWebhookSubscription deletes the subscription with the given ID, along with its pending deliveries, and reports
+// whether it existed. The subscription must belong to the domain with the given ID, or be global if domainID is 0.
+func (d *database) DeleteWebhookSubscription(domainID uint, id uint) (bool, error) {
+	var deleted bool
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("id = ?", id)
+		if domainID == 0 {
+			query = query.Where("domain_id is null")
+		} else {
+			query = query.Where("domain_id = ?", domainID)
+		}
+		sql := query.Delete(&WebhookSubscription{})
+		if sql.Error != nil {
+			return sql.Error
+		}
+		deleted = sql.RowsAffected > 0
+		if !deleted {
+			return nil
+		}
+
+		return tx.Where("subscription_id = ?", id).Delete(&WebhookDelivery{}).Error
+	})
+	return deleted, err
+}
+
+// EnqueueWebhookDeliveries adds a delivery of the event to the outbox for every global subscription and every
+// subscription of the domain with the given ID that wants the event. A domainID of 0 only matches global subscriptions.
+func (d *database) EnqueueWebhookDeliveries(domainID uint, event string, payload []byte) error {
+	var subscriptions []WebhookSubscription
+	sql := d.db.Where("domain_id is null or domain_id = ?", domainID).Find(&subscriptions)
+	if sql.Error != nil {
+		return sql.Error
+	}
+
+	now := time.Now()
+	var deliveries []WebhookDelivery
+	for _, s := range subscriptions {
+		if s.Events != "" && !slices.Contains(strings.Split(s.Events, ","), event) {
+			continue
+		}
+		deliveries = append(deliveries, WebhookDelivery{
+			SubscriptionID: s.ID,
+			Event:          event,
+			Payload:        payload,
+			NextAttemptAt:  now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return d.db.Create(&deliveries).Error
+}
+
+// ClaimWebhookDeliveries returns up to limit deliveries that are due, along with their subscriptions. Their next attempt
+// is pushed back by lease, so that they aren't claimed again while they're being delivered.
+func (d *database) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]WebhookDelivery, map[uint]WebhookSubscription, error) {
+	var deliveries []WebhookDelivery
+	subscriptions := make(map[uint]WebhookSubscription)
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		sql := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("next_attempt_at <= ?", now).
+			Order("next_attempt_at").Limit(limit).Find(&deliveries)
+		if sql.Error != nil {
+			return sql.Error
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, 0, len(deliveries))
+		subscriptionIDs := make([]uint, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			ids = append(ids, delivery.ID)
+			subscriptionIDs = append(subscriptionIDs, delivery.SubscriptionID)
+		}
+		sql = tx.Model(&WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease))
+		if sql.Error != nil {
+			return sql.Error
+		}
+
+		var subs []WebhookSubscription
+		if sql := tx.Where("id IN ?", subscriptionIDs).Find(&subs); sql.Error != nil {
+			return sql.Error
+		}
+		for _, s := range subs {
+			subscriptions[s.ID] = s
+		}
+		return nil
+	})
+	return deliveries, subscriptions, err
+}
+
+// RescheduleWebhookDelivery records a failed attempt of the delivery and when it's next attempted
+func (d *database) RescheduleWebhookDelivery(delivery WebhookDelivery) error {
+	return d.db.Model(&WebhookDelivery{ID: delivery.ID}).Updates(map[string]interface{}{
+		"attempts":        delivery.Attempts,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"last_error":      delivery.LastError,
+	}).Error
+}
+
+func (d *database) DeleteWebhookDelivery(delivery WebhookDelivery) error {
+	return d.db.Delete(&WebhookDelivery{}, delivery.ID).Error
+}
+
+// PurgeDeletedDomainsWebhookSubscriptions deletes the subscriptions of deleted domains that have no deliveries left in
+// the outbox and returns how many it deleted
+func (d *database) PurgeDeletedDomainsWebhookSubscriptions() (int64, error) {
+	sql := d.db.Where("domain_id IN (?) and id NOT IN (?)",
+		d.db.Unscoped().Model(&Domain{}).Select("id").Where("deleted_at is not null"),
+		d.db.Model(&WebhookDelivery{}).Select("subscription_id")).
+		Delete(&WebhookSubscription{})
+	return sql.RowsAffected, sql.Error
+}
+
+func (d *database) CreateAuditEntry(entry AuditEntry) error {
+	return d.db.Create(&entry).Error
+}
+
+// GetAuditEntries returns up to limit audit entries, newest first, optionally only those of the domain with the given ID
+// or name and those older than the entry with ID beforeID
+func (d *database) GetAuditEntries(domainID uint, domainName string, beforeID uint, limit int) ([]AuditEntry, error) {
+	query := d.db.Order("id desc").Limit(limit)
+	if domainID != 0 {
+		query = query.Where("domain_id = ?", domainID)
+	}
+	if domainName != "" {
+		query = query.Where("domain = ?", domainName)
+	}
+	if beforeID != 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+
+	var entries []AuditEntry
+	sql := query.Find(&entries)
+	return entries, sql.Error
+}
+
+func (d *database) PurgeOldAuditEntries(maxAgeSeconds int64) (int64, error) {
+	expiry := time.Now().Add(-time.Second * time.Duration(maxAgeSeconds))
+	sql := d.db.Where("created_at < ?", expiry).Delete(&AuditEntry{})
+	return sql.RowsAffected, sql.Error
+}
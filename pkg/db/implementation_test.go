@@ -0,0 +1,88 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestDomainNameInUse(t *testing.T) {
+	d := newTestDatabase(t)
+	for _, domain := range []Domain{
+		{UniqueSlug: "www.abc.example.org", Domain: ".www.abc.example.org", Zone: "example.org"},
+		{UniqueSlug: "shop.example.net", Domain: ".shop.example.net", Zone: "example.net"},
+	} {
+		if err := d.db.Create(&domain).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		domainName string
+		want       bool
+	}{
+		{name: "same name", domainName: ".shop.example.net", want: true},
+		{name: "above a domain", domainName: ".abc.example.org", want: true},
+		{name: "below a domain", domainName: ".api.shop.example.net", want: true},
+		{name: "unrelated", domainName: ".blog.example.net"},
+		{name: "underscore isn't a wildcard", domainName: ".a_c.example.org"},
+		{name: "percent sign isn't a wildcard", domainName: ".%.example.org"},
+		{name: "escape character", domainName: ".a!c.example.org"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := domainNameInUse(d.db, tt.domainName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("domainNameInUse(%q) = %v, want %v", tt.domainName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimWebhookDeliveries(t *testing.T) {
+	d := newTestDatabase(t)
+	subscription, err := d.CreateWebhookSubscription(WebhookSubscription{URL: "https://example.com/hook"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range []string{"domain.created", "record.created", "record.deleted"} {
+		if err := d.EnqueueWebhookDeliveries(1, event, []byte("{}")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		limit      int
+		lease      time.Duration
+		wantEvents []string
+	}{
+		{name: "up to the limit", limit: 2, lease: time.Hour, wantEvents: []string{"domain.created", "record.created"}},
+		{name: "leased deliveries are left out", limit: 10, lease: -time.Second, wantEvents: []string{"record.deleted"}},
+		{name: "expired leases are claimed again", limit: 10, lease: time.Hour, wantEvents: []string{"record.deleted"}},
+		{name: "nothing due", limit: 10, lease: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deliveries, subscriptions, err := d.ClaimWebhookDeliveries(tt.limit, tt.lease)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var events []string
+			for _, delivery := range deliveries {
+				events = append(events, delivery.Event)
+				if subscriptions[delivery.SubscriptionID].URL != subscription.URL {
+					t.Errorf("subscription of delivery %v = %+v, want %+v", delivery.ID, subscriptions[delivery.SubscriptionID], subscription)
+				}
+			}
+			if !slices.Equal(events, tt.wantEvents) {
+				t.Errorf("claimed %v, want %v", events, tt.wantEvents)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// dropLegacyRecordIndex drops the old unique index on records' FQDN and type. It was replaced by idx_record_set, which
+// also includes the set identifier so that records with routing policies can share a name.
+func dropLegacyRecordIndex(db *gorm.DB) error {
+	if db.Migrator().HasIndex(&Record{}, "idx_record") {
+		logrus.Infof("Dropping legacy index idx_record")
+		return db.Migrator().DropIndex(&Record{}, "idx_record")
+	}
+	return nil
+}
+
+// migrateLegacyValues moves values stored in the old comma-joined records.values column into the record_values table.
+// The split is only as accurate as the old format was: values that contained commas were already ambiguous when they
+// were written.
+func migrateLegacyValues(db *gorm.DB) error {
+	var records []Record
+	sql := db.Where(clause.Neq{Column: clause.Column{Name: "values"}, Value: ""}).Find(&records)
+	if sql.Error != nil {
+		return sql.Error
+	}
+
+	if len(records) > 0 {
+		logrus.Infof("Migrating values of %v records to the record_values table", len(records))
+	}
+
+	for _, r := range records {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			values := NewRecordValues(strings.Split(r.LegacyValues, ","))
+			for i := range values {
+				values[i].RecordID = r.ID
+			}
+			if sql := tx.Create(&values); sql.Error != nil {
+				return sql.Error
+			}
+
+			return tx.Model(&Record{ID: r.ID}).Update("values", "").Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dropDomainCreationResponses deletes the idempotency keys of domain creations that were stored along with the response,
+// which held the new domain's token. Tokens are otherwise only ever stored hashed.
+func dropDomainCreationResponses(db *gorm.DB) error {
+	sql := db.Where(&IdempotencyKey{Scope: "POST /v1/domains"}).Delete(&IdempotencyKey{})
+	if sql.RowsAffected > 0 {
+		logrus.Infof("Dropped %v stored domain creation responses", sql.RowsAffected)
+	}
+	return sql.Error
+}
+
+// migrateDomainZones sets the zone of domains created before there could be more than one. A domain's name is its slug
+// followed by its zone's name, so the zone is what's left of the name without the slug.
+func migrateDomainZones(db *gorm.DB) error {
+	var domains []Domain
+	sql := db.Unscoped().Where("zone = ?", "").Find(&domains)
+	if sql.Error != nil {
+		return sql.Error
+	}
+
+	if len(domains) > 0 {
+		logrus.Infof("Setting the zone of %v domains", len(domains))
+	}
+
+	for _, d := range domains {
+		zone := strings.TrimPrefix(d.Domain, "."+d.UniqueSlug+".")
+		if sql := db.Unscoped().Model(&Domain{Model: gorm.Model{ID: d.ID}}).Update("zone", zone); sql.Error != nil {
+			return sql.Error
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+// newTestDatabase creates an empty, fully migrated sqlite database
+func newTestDatabase(t *testing.T) *database {
+	t.Helper()
+	d, err := New(context.Background(), "sqlite", "file:"+filepath.Join(t.TempDir(), "test.sqlite"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d.(*database)
+}
+
+func TestMigrateLegacyValues(t *testing.T) {
+	d := newTestDatabase(t)
+	domain := Domain{UniqueSlug: "abc123", Domain: ".abc123.example.com"}
+	if err := d.db.Create(&domain).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		legacyValues string
+		values       []string
+		want         []string
+	}{
+		{name: "single value", legacyValues: "1.1.1.1", want: []string{"1.1.1.1"}},
+		{name: "several values", legacyValues: "1.1.1.1,2.2.2.2,3.3.3.3", want: []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"}},
+		{name: "already migrated", values: []string{"4.4.4.4"}, want: []string{"4.4.4.4"}},
+	}
+
+	records := make([]Record, len(tests))
+	for i, tt := range tests {
+		records[i] = Record{
+			FQDN:         tt.name + domain.Domain,
+			Type:         "A",
+			DomainID:     domain.ID,
+			LegacyValues: tt.legacyValues,
+		}
+		for _, v := range tt.values {
+			records[i].Values = append(records[i].Values, RecordValue{Value: v})
+		}
+		if err := d.db.Create(&records[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := migrateLegacyValues(d.db); err != nil {
+		t.Fatal(err)
+	}
+	// Migrated records are left alone when the migration runs again
+	if err := migrateLegacyValues(d.db); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var record Record
+			if err := d.db.Preload("Values").First(&record, records[i].ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if record.LegacyValues != "" {
+				t.Errorf("legacy values = %q, want them cleared", record.LegacyValues)
+			}
+			if got := record.ValueStrings(); !slices.Equal(got, tt.want) {
+				t.Errorf("values = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrateDomainZones(t *testing.T) {
+	d := newTestDatabase(t)
+
+	tests := []struct {
+		name    string
+		domain  Domain
+		deleted bool
+		want    string
+	}{
+		{name: "legacy domain", domain: Domain{UniqueSlug: "abc123", Domain: ".abc123.example.com"}, want: "example.com"},
+		{name: "legacy domain in nested zone", domain: Domain{UniqueSlug: "def456", Domain: ".def456.on.example.org"}, want: "on.example.org"},
+		{name: "deleted legacy domain", domain: Domain{UniqueSlug: "ghi789", Domain: ".ghi789.example.com"}, deleted: true, want: "example.com"},
+		{name: "domain with zone", domain: Domain{UniqueSlug: "jkl012", Domain: ".jkl012.example.net", Zone: "example.net"}, want: "example.net"},
+	}
+
+	for i := range tests {
+		if err := d.db.Create(&tests[i].domain).Error; err != nil {
+			t.Fatal(err)
+		}
+		if tests[i].deleted {
+			if err := d.db.Delete(&tests[i].domain).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := migrateDomainZones(d.db); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var domain Domain
+			if err := d.db.Unscoped().First(&domain, tt.domain.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if domain.Zone != tt.want {
+				t.Errorf("zone = %q, want %q", domain.Zone, tt.want)
+			}
+			if domain.DeletedAt.Valid != tt.deleted {
+				t.Errorf("deleted = %v, want %v", domain.DeletedAt.Valid, tt.deleted)
+			}
+		})
+	}
+}
@@ -1,27 +1,241 @@
 package db
 
 import (
+	"sort"
 	"time"
 
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"golang.org/x/exp/slices"
 	"gorm.io/gorm"
 )
 
 type Domain struct {
 	gorm.Model
-	UniqueSlug  string `gorm:"uniqueIndex"`
-	Domain      string `gorm:"uniqueIndex"`
+	UniqueSlug string `gorm:"uniqueIndex"`
+	Domain     string `gorm:"uniqueIndex"`
+	// Zone is the name of the hosted zone the domain was created in. Slugs are unique across all zones.
+	Zone string `gorm:"index"`
+	// SubZoneID is the ID of the domain's own hosted zone, delegated from its zone, if it has one
+	SubZoneID   string `gorm:"index"`
 	TokenHash   string
 	LastCheckIn time.Time
 	Version     string
+	// Revision is incremented whenever any of the domain's records change
+	Revision int64 `gorm:"not null;default:0"`
+	// SuspendedAt is set while the domain is in its grace period: it has expired and whatever records it had left have
+	// been removed from its zone, but renewing it still reclaims its name and token
+	SuspendedAt *time.Time
+	// NeverExpires is set for domains registered through the acme-dns API, whose clients have no way to renew them
+	NeverExpires bool `gorm:"not null;default:false"`
+
+	// These override the server's default quotas for the domain when they are set
+	MaxRecords            *int64
+	MaxValuesPerRecord    *int64
+	MaxMutationsPerMinute *int64
 }
 
 type Record struct {
 	ID          uint   `gorm:"primarykey"`
-	FQDN        string `gorm:"uniqueIndex:idx_record,priority:1"`
-	Type        string `gorm:"uniqueIndex:idx_record,priority:2"`
+	FQDN        string `gorm:"uniqueIndex:idx_record_set,priority:1"`
+	Type        string `gorm:"uniqueIndex:idx_record_set,priority:2"`
 	DomainID    uint
-	Domain      Domain `gorm:"constraint:OnDelete:SET NULL;"`
-	Values      string `gorm:"type:text"` // Intentionally denormalized because we don't want to create a values table
+	Domain      Domain        `gorm:"constraint:OnDelete:SET NULL;"`
+	Values      []RecordValue `gorm:"constraint:OnDelete:CASCADE;"`
+	TTL         int64
+	Alias       model.AliasTarget `gorm:"embedded;embeddedPrefix:alias_"`
 	CreatedAt   time.Time
 	LastCheckIn time.Time
+	// Revision is the domain's revision as of the record's last change. Since the domain's revision only ever grows, a
+	// record that is deleted and created again never gets a revision it had before.
+	Revision int64 `gorm:"not null;default:0"`
+
+	// SetIdentifier is empty unless the record has a routing policy, in which case the remaining routing fields
+	// describe it. This is what allows several records with the same FQDN and type.
+	SetIdentifier string `gorm:"uniqueIndex:idx_record_set,priority:3;not null;default:''"`
+	RoutingPolicy string
+	Weight        int64
+	Failover      string
+	HealthCheckID string
+
+	// LegacyValues is the old comma-joined representation of Values. It is only read by the migration that moves
+	// its contents into the record_values table and is empty for every record written since.
+	LegacyValues string `gorm:"column:values;type:text"`
+}
+
+// HealthCheck is a provider health check created for a record. It is deleted along with the record, so it has no
+// foreign key constraint: the record's row may be gone before the provider's health check has been cleaned up.
+type HealthCheck struct {
+	ID               uint   `gorm:"primarykey"`
+	ProviderID       string `gorm:"uniqueIndex"`
+	DomainID         uint   `gorm:"index"`
+	RecordID         uint   `gorm:"index"`
+	FQDN             string
+	SetIdentifier    string
+	Type             string
+	IPAddress        string
+	Port             int64
+	ResourcePath     string
+	FailureThreshold int64
+	RequestInterval  int64
+	CreatedAt        time.Time
+}
+
+// IdempotencyKey holds the response to a request that was made with an Idempotency-Key header, so that the response can
+// be replayed when the request is retried. Keys are scoped to the method and path of the request. A key without a status
+// belongs to a request that is still being handled.
+type IdempotencyKey struct {
+	ID          uint   `gorm:"primarykey"`
+	Scope       string `gorm:"uniqueIndex:idx_idempotency_key,priority:1"`
+	Key         string `gorm:"uniqueIndex:idx_idempotency_key,priority:2"`
+	RequestHash string
+	Status      int
+	Body        []byte
+	CreatedAt   time.Time `gorm:"index"`
+}
+
+// RateLimitBucket is the state of a token bucket rate limiter. Keeping it in the database shares the limit between all
+// replicas of the server.
+type RateLimitBucket struct {
+	Key        string `gorm:"primarykey"`
+	Tokens     float64
+	RefilledAt time.Time `gorm:"index"`
+}
+
+// NameRule is a rule, managed by operators, that denies the use of slugs or record labels
+type NameRule struct {
+	ID        uint `gorm:"primarykey"`
+	Kind      string
+	Pattern   string
+	Regex     bool
+	CreatedAt time.Time
+}
+
+// Invitation is issued by operators to let domains be created with a slug of the creator's choosing. Only a hash of its
+// code is stored.
+type Invitation struct {
+	ID            uint   `gorm:"primarykey"`
+	CodeHash      string `gorm:"uniqueIndex"`
+	RemainingUses int64
+	CreatedAt     time.Time
+}
+
+// CustomDomainVerification is a pending request for a domain under a name the requester owns. The domain is created
+// once a TXT record holding Challenge is found, which proves the requester controls the name's DNS.
+type CustomDomainVerification struct {
+	ID        uint   `gorm:"primarykey"`
+	Name      string `gorm:"uniqueIndex"`
+	Zone      string
+	TokenHash string
+	Challenge string
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// WebhookSubscription is a URL that events are delivered to. A subscription without a domain is global and gets the
+// events of every domain, as well as those that don't belong to a domain.
+type WebhookSubscription struct {
+	ID       uint  `gorm:"primarykey"`
+	DomainID *uint `gorm:"index"`
+	URL      string
+	// Secret is the key deliveries are signed with. It can't be hashed, since it's needed to sign.
+	Secret string
+	// Events is the comma separated list of events that are delivered. Every event is delivered when it's empty.
+	Events    string
+	CreatedAt time.Time
+}
+
+// AuditEntry records a change made to a domain or its records, and who made it. Entries are never changed, only
+// deleted once they're older than the audit log's max age. They outlive the domain they belong to, so DomainID has no
+// foreign key constraint.
+type AuditEntry struct {
+	ID         uint   `gorm:"primarykey"`
+	DomainID   uint   `gorm:"index"`
+	Domain     string `gorm:"index"`
+	Operation  string
+	TokenID    string
+	RemoteIP   string
+	RemoteAddr string
+	UserAgent  string
+	// Before and After are the JSON encoded records the operation changed, as they were before and after it
+	Before    []byte
+	After     []byte
+	ChangeID  string
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// WebhookDelivery is an event waiting in the outbox to be delivered to a subscription. It is deleted once it's
+// delivered or has run out of attempts.
+type WebhookDelivery struct {
+	ID             uint `gorm:"primarykey"`
+	SubscriptionID uint `gorm:"index"`
+	Event          string
+	Payload        []byte
+	Attempts       int64
+	NextAttemptAt  time.Time `gorm:"index"`
+	LastError      string
+	CreatedAt      time.Time
+}
+
+// Pair returns the key identifying the record's record set
+func (r Record) Pair() model.FQDNTypePair {
+	return model.FQDNTypePair{FQDN: r.FQDN, Type: r.Type, SetIdentifier: r.SetIdentifier}
+}
+
+// Routing returns the record's routing policy, or nil if it doesn't have one
+func (r Record) Routing() *model.RoutingPolicy {
+	if r.SetIdentifier == "" {
+		return nil
+	}
+	return &model.RoutingPolicy{
+		Type:          r.RoutingPolicy,
+		SetIdentifier: r.SetIdentifier,
+		Weight:        r.Weight,
+		Failover:      r.Failover,
+		HealthCheckID: r.HealthCheckID,
+	}
+}
+
+// SetRouting sets the record's routing fields from policy, which may be nil
+func (r *Record) SetRouting(policy *model.RoutingPolicy) {
+	if policy == nil {
+		policy = &model.RoutingPolicy{}
+	}
+	r.RoutingPolicy = policy.Type
+	r.SetIdentifier = policy.SetIdentifier
+	r.Weight = policy.Weight
+	r.Failover = policy.Failover
+	r.HealthCheckID = policy.HealthCheckID
+}
+
+type RecordValue struct {
+	ID       uint   `gorm:"primarykey"`
+	RecordID uint   `gorm:"index"`
+	Value    string `gorm:"type:text"`
+	// ExpiresAt is only set for values that are removed automatically, such as ACME challenges
+	ExpiresAt *time.Time `gorm:"index"`
+}
+
+// ValueStrings returns the record's values, sorted so they can be compared against a request's values
+func (r Record) ValueStrings() []string {
+	values := make([]string, 0, len(r.Values))
+	for _, v := range r.Values {
+		values = append(values, v.Value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// HasValues reports whether the record's values are the same set as values, regardless of order
+func (r Record) HasValues(values []string) bool {
+	sorted := slices.Clone(values)
+	sort.Strings(sorted)
+	return slices.Equal(r.ValueStrings(), sorted)
+}
+
+// NewRecordValues converts values to RecordValues that can be set on a Record
+func NewRecordValues(values []string) []RecordValue {
+	recordValues := make([]RecordValue, 0, len(values))
+	for _, v := range values {
+		recordValues = append(recordValues, RecordValue{Value: v})
+	}
+	return recordValues
 }
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// These are the operations recorded in the audit log
+const (
+	AuditDomainCreate  = "domain.create"
+	AuditDomainRenew   = "domain.renew"
+	AuditDomainPurge   = "domain.purge"
+	AuditDomainRestore = "domain.restore"
+	// AuditDomainSuspend is recorded when an expired domain's records are taken out of its zone for its grace period
+	AuditDomainSuspend = "domain.suspend"
+	// AuditDomainResume is recorded when a suspended domain's records are put back in its zone
+	AuditDomainResume = "domain.resume"
+	// AuditDomainErase is recorded when a deleted domain is deleted for good, once it can no longer be restored
+	AuditDomainErase  = "domain.erase"
+	AuditRecordCreate = "record.create"
+	AuditRecordUpdate = "record.update"
+	AuditRecordDelete = "record.delete"
+	AuditRecordsBatch = "records.batch"
+	AuditRecordsSync  = "records.sync"
+	AuditRecordsPurge = "records.purge"
+	// AuditZonePurge is recorded when the purger removes records that don't belong to any domain from a zone
+	AuditZonePurge = "zone.purge"
+)
+
+// AdminTokenID is the token identifier of requests made with the admin token
+const AdminTokenID = "admin"
+
+// Actor identifies who made a change. Changes the server makes on its own, such as purging, have no actor.
+type Actor struct {
+	// TokenID identifies the token the request was authenticated with, without revealing the token
+	TokenID string
+	// RemoteIP is the address of the client, which is taken from the X-Forwarded-For header of trusted proxies
+	RemoteIP string
+	// RemoteAddr is the address the request's connection came from
+	RemoteAddr string
+	UserAgent  string
+}
+
+// TokenID returns the identifier of a token, which is the start of its SHA-256 hash. Tokens are random, so it's as
+// good as unique for the tokens of a domain, but it can't be used to authenticate.
+func TokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:6])
+}
+
+// AuditEntryResponse is an entry of the audit log. Before and After are the states of the records the operation
+// changed, and ChangeID is the ID of the Route53 change that made it, if there was one.
+type AuditEntryResponse struct {
+	ID         uint             `json:"id"`
+	Time       string           `json:"time"`
+	Domain     string           `json:"domain,omitempty"`
+	Operation  string           `json:"operation"`
+	TokenID    string           `json:"tokenId,omitempty"`
+	RemoteIP   string           `json:"remoteIp,omitempty"`
+	RemoteAddr string           `json:"remoteAddr,omitempty"`
+	UserAgent  string           `json:"userAgent,omitempty"`
+	Before     []RecordResponse `json:"before,omitempty"`
+	After      []RecordResponse `json:"after,omitempty"`
+	ChangeID   string           `json:"changeId,omitempty"`
+}
+
+// AuditLogResponse is a page of the audit log, newest entry first. Next is the cursor of the following page, if there
+// is one.
+type AuditLogResponse struct {
+	Entries []AuditEntryResponse `json:"entries"`
+	Next    string               `json:"next,omitempty"`
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ETag returns the entity tag of a resource with the given revision
+func ETag(revision int64) string {
+	return strconv.Quote(strconv.FormatInt(revision, 10))
+}
+
+// Precondition holds the conditions of a request's If-Match and If-None-Match headers
+type Precondition struct {
+	IfMatch     string
+	IfNoneMatch string
+}
+
+// Met reports whether the precondition holds for a resource with the given entity tag, which is empty if the resource
+// doesn't exist. As in RFC 9110, If-Match uses the strong comparison and If-None-Match the weak one.
+func (p Precondition) Met(etag string) bool {
+	if p.IfMatch != "" {
+		if etag == "" {
+			return false
+		}
+		if !matchesETag(p.IfMatch, etag, false) {
+			return false
+		}
+	}
+	if p.IfNoneMatch != "" {
+		if etag != "" && matchesETag(p.IfNoneMatch, etag, true) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesETag reports whether etag is among the comma-separated entity tags of header, or header is "*"
+func matchesETag(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
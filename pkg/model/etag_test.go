@@ -0,0 +1,52 @@
+package model
+
+import "testing"
+
+func TestETag(t *testing.T) {
+	tests := []struct {
+		revision int64
+		want     string
+	}{
+		{revision: 0, want: `"0"`},
+		{revision: 1, want: `"1"`},
+		{revision: 1234567890123, want: `"1234567890123"`},
+	}
+	for _, tt := range tests {
+		if got := ETag(tt.revision); got != tt.want {
+			t.Errorf("ETag(%v) = %v, want %v", tt.revision, got, tt.want)
+		}
+	}
+}
+
+func TestPreconditionMet(t *testing.T) {
+	tests := []struct {
+		name         string
+		precondition Precondition
+		etag         string
+		want         bool
+	}{
+		{name: "none", etag: `"1"`, want: true},
+		{name: "none on missing resource", want: true},
+		{name: "if-match matches", precondition: Precondition{IfMatch: `"1"`}, etag: `"1"`, want: true},
+		{name: "if-match differs", precondition: Precondition{IfMatch: `"1"`}, etag: `"2"`},
+		{name: "if-match one of several", precondition: Precondition{IfMatch: `"1", "2"`}, etag: `"2"`, want: true},
+		{name: "if-match any", precondition: Precondition{IfMatch: "*"}, etag: `"2"`, want: true},
+		{name: "if-match any on missing resource", precondition: Precondition{IfMatch: "*"}},
+		{name: "if-match on missing resource", precondition: Precondition{IfMatch: `"1"`}},
+		{name: "if-match ignores weak tags", precondition: Precondition{IfMatch: `W/"1"`}, etag: `"1"`},
+		{name: "if-none-match any on missing resource", precondition: Precondition{IfNoneMatch: "*"}, want: true},
+		{name: "if-none-match any on existing resource", precondition: Precondition{IfNoneMatch: "*"}, etag: `"1"`},
+		{name: "if-none-match matches", precondition: Precondition{IfNoneMatch: `"1"`}, etag: `"1"`},
+		{name: "if-none-match differs", precondition: Precondition{IfNoneMatch: `"1"`}, etag: `"2"`, want: true},
+		{name: "if-none-match weak tag matches", precondition: Precondition{IfNoneMatch: `W/"1"`}, etag: `"1"`},
+		{name: "both met", precondition: Precondition{IfMatch: `"2"`, IfNoneMatch: `"1"`}, etag: `"2"`, want: true},
+		{name: "if-none-match fails despite if-match", precondition: Precondition{IfMatch: `"2"`, IfNoneMatch: `"2"`}, etag: `"2"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.precondition.Met(tt.etag); got != tt.want {
+				t.Errorf("%+v.Met(%q) = %v, want %v", tt.precondition, tt.etag, got, tt.want)
+			}
+		})
+	}
+}
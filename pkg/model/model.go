@@ -9,20 +9,290 @@ const (
 	RecordTypeAAAA  = "AAAA"
 	RecordTypeCname = "CNAME"
 	RecordTypeTxt   = "TXT"
+	RecordTypeMx    = "MX"
+	RecordTypeSrv   = "SRV"
+	RecordTypeCaa   = "CAA"
+	// RecordTypeAlias is a Route53 alias record. It is created as an A record whose address is resolved by Route53 from
+	// an AWS resource, such as a load balancer.
+	RecordTypeAlias = "ALIAS"
+)
+
+const (
+	RoutingPolicyWeighted = "weighted"
+	RoutingPolicyFailover = "failover"
+
+	FailoverPrimary   = "PRIMARY"
+	FailoverSecondary = "SECONDARY"
 )
 
 func IsValidRecordType(rt string) error {
 	switch rt {
-	case RecordTypeA, RecordTypeAAAA, RecordTypeCname, RecordTypeTxt:
+	case RecordTypeA, RecordTypeAAAA, RecordTypeCname, RecordTypeTxt, RecordTypeMx, RecordTypeSrv, RecordTypeCaa,
+		RecordTypeAlias:
 		return nil
 	}
 
 	return fmt.Errorf("invalid record type")
 }
 
+// DomainRequest is the optional body of a request to create a domain
+type DomainRequest struct {
+	// Slug requests a specific slug instead of a random one
+	Slug string `json:"slug,omitempty"`
+	// Zone is the name of the zone to create the domain in. The server's default zone is used when it's empty.
+	Zone string `json:"zone,omitempty"`
+}
+
+type CustomDomainRequest struct {
+	Name string `json:"name"`
+}
+
+// CustomDomainResponse holds the TXT record that must be published to verify a custom domain, along with the token the
+// domain is accessed with once it's verified
+type CustomDomainResponse struct {
+	Name      string        `json:"name"`
+	Zone      string        `json:"zone,omitempty"`
+	Token     string        `json:"token,omitempty"`
+	Challenge RecordRequest `json:"challenge"`
+}
+
+// DNSSECResponse describes the DNSSEC signing of a zone. The DS records of its key-signing keys are what has to be
+// published in the parent zone for resolvers to validate the zone's signatures.
+type DNSSECResponse struct {
+	Zone           string          `json:"zone"`
+	Status         string          `json:"status"`
+	StatusMessage  string          `json:"statusMessage,omitempty"`
+	KeySigningKeys []KeySigningKey `json:"keySigningKeys"`
+}
+
+type KeySigningKey struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	KeyTag   int64  `json:"keyTag"`
+	DSRecord string `json:"dsRecord"`
+}
+
+// These are the events webhooks are notified of
+const (
+	EventDomainCreated = "domain.created"
+	// EventDomainExpiring is sent when a domain will expire by the next purge unless it's renewed
+	EventDomainExpiring = "domain.expiring"
+	// EventDomainSuspended is sent when a domain expires and stops resolving. Its name and token can still be reclaimed
+	// by renewing it until its grace period ends, when it's purged.
+	EventDomainSuspended = "domain.suspended"
+	EventDomainPurged    = "domain.purged"
+	// EventDomainRestored is sent when an operator restores a purged domain
+	EventDomainRestored = "domain.restored"
+	EventRecordCreated  = "record.created"
+	EventRecordDeleted  = "record.deleted"
+	// EventRecordsPurged is sent when a domain's records are purged, either through the API or because they weren't renewed
+	EventRecordsPurged = "records.purged"
+	// EventZoneRecordsPurged is sent when the purger removes records that don't belong to any domain from a zone. Only
+	// global subscriptions receive it.
+	EventZoneRecordsPurged = "zone.records_purged"
+)
+
+var WebhookEvents = []string{
+	EventDomainCreated,
+	EventDomainExpiring,
+	EventDomainSuspended,
+	EventDomainPurged,
+	EventDomainRestored,
+	EventRecordCreated,
+	EventRecordDeleted,
+	EventRecordsPurged,
+	EventZoneRecordsPurged,
+}
+
+type WebhookRequest struct {
+	URL string `json:"url"`
+	// Events are the events to deliver. Every event is delivered when it's empty.
+	Events []string `json:"events,omitempty"`
+}
+
+type WebhookResponse struct {
+	ID     uint     `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+	// Secret is the key deliveries are signed with. It is only returned when the subscription is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhookPayload is the body of a webhook delivery. It is signed with the subscription's secret, and the signature is sent
+// in the X-Acorn-DNS-Signature header as "sha256=" followed by the hex encoded HMAC-SHA256 of the body.
+type WebhookPayload struct {
+	ID         string      `json:"id"`
+	Event      string      `json:"event"`
+	Domain     string      `json:"domain,omitempty"`
+	OccurredAt string      `json:"occurredAt"`
+	Data       interface{} `json:"data,omitempty"`
+}
+
+// WebhookRecordsData is the data of the events about records being deleted or purged
+type WebhookRecordsData struct {
+	Zone    string         `json:"zone,omitempty"`
+	Records []FQDNTypePair `json:"records"`
+}
+
+type ZoneResponse struct {
+	Name    string `json:"name"`
+	Default bool   `json:"default,omitempty"`
+}
+
+type SlugAvailabilityResponse struct {
+	Slug      string `json:"slug"`
+	Available bool   `json:"available"`
+	// Reason says why the slug isn't available
+	Reason string `json:"reason,omitempty"`
+}
+
+type InvitationRequest struct {
+	// Uses is how many domains the invitation can create. It defaults to 1.
+	Uses int64 `json:"uses,omitempty"`
+}
+
+type InvitationResponse struct {
+	ID uint `json:"id"`
+	// Code is only included when the invitation is created
+	Code          string `json:"code,omitempty"`
+	RemainingUses int64  `json:"remainingUses"`
+}
+
 type DomainResponse struct {
+	Name   string         `json:"name,omitempty"`
+	Zone   string         `json:"zone,omitempty"`
+	Token  string         `json:"token,omitempty"`
+	ETag   string         `json:"etag,omitempty"`
+	Quota  *QuotaResponse `json:"quota,omitempty"`
+	Expiry *DomainExpiry  `json:"expiry,omitempty"`
+}
+
+const (
+	DomainStatusActive = "active"
+	// DomainStatusGrace is the status of a domain that has expired. Its records don't resolve, but renewing it reclaims
+	// its name and token until its grace period ends.
+	DomainStatusGrace = "grace"
+)
+
+// DomainExpiry says when a domain expires unless it's renewed. The times are in RFC 3339 format.
+type DomainExpiry struct {
+	Status        string `json:"status"`
+	ExpiresAt     string `json:"expiresAt"`
+	GraceEndsAt   string `json:"graceEndsAt"`
+	DaysRemaining int64  `json:"daysRemaining"`
+}
+
+// DomainQuota holds the limits on a domain's records. A limit of 0 means there is none.
+type DomainQuota struct {
+	MaxRecords         int64 `json:"maxRecords"`
+	MaxValuesPerRecord int64 `json:"maxValuesPerRecord"`
+	// MaxMutationsPerMinute limits the requests that change the domain's records
+	MaxMutationsPerMinute int64 `json:"maxMutationsPerMinute"`
+}
+
+// DomainQuotaOverride overrides the server's default quota for a domain. The limits that aren't set use the default.
+type DomainQuotaOverride struct {
+	MaxRecords            *int64 `json:"maxRecords,omitempty"`
+	MaxValuesPerRecord    *int64 `json:"maxValuesPerRecord,omitempty"`
+	MaxMutationsPerMinute *int64 `json:"maxMutationsPerMinute,omitempty"`
+}
+
+type QuotaUsage struct {
+	Records int64 `json:"records"`
+	// MutationsAvailable is how many changes can be made right away before the per minute limit applies
+	MutationsAvailable int64 `json:"mutationsAvailable"`
+}
+
+type QuotaResponse struct {
+	Limits DomainQuota `json:"limits"`
+	Usage  QuotaUsage  `json:"usage"`
+	// Override is only included in responses to operators
+	Override *DomainQuotaOverride `json:"override,omitempty"`
+}
+
+type RoutingPolicy struct {
+	// Type is either weighted or failover
+	Type          string `json:"type,omitempty"`
+	SetIdentifier string `json:"setIdentifier,omitempty"`
+	// Weight is only used by weighted records
+	Weight int64 `json:"weight,omitempty"`
+	// Failover is only used by failover records and is either PRIMARY or SECONDARY
+	Failover      string `json:"failover,omitempty"`
+	HealthCheckID string `json:"healthCheckId,omitempty"`
+}
+
+// SetIdentifier returns the set identifier of the request's routing policy, if it has one
+func (r RecordRequest) SetIdentifier() string {
+	if r.RoutingPolicy == nil {
+		return ""
+	}
+	return r.RoutingPolicy.SetIdentifier
+}
+
+const (
+	HealthCheckTypeHTTP  = "HTTP"
+	HealthCheckTypeHTTPS = "HTTPS"
+	HealthCheckTypeTCP   = "TCP"
+
+	HealthStatusHealthy   = "healthy"
+	HealthStatusUnhealthy = "unhealthy"
+	HealthStatusUnknown   = "unknown"
+)
+
+type HealthCheckRequest struct {
+	// Record is the name of the A record the health check is bound to, as it was given when creating the record
+	Record string `json:"record,omitempty"`
+	// SetIdentifier selects the record set when the record has a routing policy
+	SetIdentifier string `json:"setIdentifier,omitempty"`
+	Type          string `json:"type,omitempty"`
+	// IPAddress is the address to check. It must be one of the record's values and can be omitted if the record has
+	// only one.
+	IPAddress        string `json:"ipAddress,omitempty"`
+	Port             int64  `json:"port,omitempty"`
+	ResourcePath     string `json:"resourcePath,omitempty"`
+	FailureThreshold int64  `json:"failureThreshold,omitempty"`
+	RequestInterval  int64  `json:"requestInterval,omitempty"`
+}
+
+type HealthCheckResponse struct {
+	HealthCheckRequest
+	// ID is the provider's ID for the health check. It can be used as the health check ID of a record's routing policy.
+	ID     string `json:"id,omitempty"`
+	FQDN   string `json:"fqdn,omitempty"`
+	Status string `json:"status,omitempty"`
+}
+
+type ACMEChallengeRequest struct {
+	// Name is the name being validated, relative to the domain. Empty means the domain itself, and wildcard names share
+	// the challenge record of the name they're a wildcard for.
 	Name  string `json:"name,omitempty"`
-	Token string `json:"token,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// ACMEDNSRegisterRequest and the types below implement the API of acme-dns (https://github.com/joohoi/acme-dns)
+type ACMEDNSRegisterRequest struct {
+	AllowFrom []string `json:"allowfrom,omitempty"`
+}
+
+type ACMEDNSRegisterResponse struct {
+	Username   string   `json:"username"`
+	Password   string   `json:"password"`
+	FullDomain string   `json:"fulldomain"`
+	SubDomain  string   `json:"subdomain"`
+	AllowFrom  []string `json:"allowfrom"`
+}
+
+type ACMEDNSUpdateRequest struct {
+	SubDomain string `json:"subdomain"`
+	TXT       string `json:"txt"`
+}
+
+type ACMEDNSUpdateResponse struct {
+	TXT string `json:"txt"`
+}
+
+type ACMEDNSErrorResponse struct {
+	Error string `json:"error"`
 }
 
 type RenewRequest struct {
@@ -37,15 +307,95 @@ type RenewResponse struct {
 	OutOfSyncRecords []FQDNTypePair `json:"outOfSyncRecords,omitempty"`
 }
 
+// RecordSyncRequest holds the complete set of records a domain should have
+type RecordSyncRequest struct {
+	Records []RecordRequest `json:"records,omitempty"`
+	Version string          `json:"version,omitempty"`
+}
+
+// RecordSyncResponse lists the changes that were made to bring the domain's records in line with a RecordSyncRequest
+type RecordSyncResponse struct {
+	Name    string         `json:"name,omitempty"`
+	Created []FQDNTypePair `json:"created,omitempty"`
+	Updated []FQDNTypePair `json:"updated,omitempty"`
+	Deleted []FQDNTypePair `json:"deleted,omitempty"`
+}
+
 type RecordRequest struct {
 	Name   string   `json:"name,omitempty"`
 	Type   string   `json:"type,omitempty"`
 	Values []string `json:"values,omitempty"`
+	TTL    int64    `json:"ttl,omitempty"`
+	// AliasTarget must be set for ALIAS records, which have no values, and only for them
+	AliasTarget *AliasTarget `json:"aliasTarget,omitempty"`
+	// RoutingPolicy lets several record sets, each with its own set identifier, share a name and type
+	RoutingPolicy *RoutingPolicy `json:"routingPolicy,omitempty"`
+}
+
+type AliasTarget struct {
+	HostedZoneID         string `json:"hostedZoneId,omitempty"`
+	DNSName              string `json:"dnsName,omitempty"`
+	EvaluateTargetHealth bool   `json:"evaluateTargetHealth,omitempty"`
+}
+
+// RecordValuesRequest adds values to and removes values from a record without replacing its other values
+type RecordValuesRequest struct {
+	Type string `json:"type,omitempty"`
+	// SetIdentifier selects the record set when the record has a routing policy
+	SetIdentifier string   `json:"setIdentifier,omitempty"`
+	Add           []string `json:"add,omitempty"`
+	Remove        []string `json:"remove,omitempty"`
+}
+
+const (
+	BatchActionCreate = "create"
+	BatchActionUpdate = "update"
+	BatchActionDelete = "delete"
+)
+
+type RecordBatchRequest struct {
+	Operations []RecordBatchOperation `json:"operations,omitempty"`
+}
+
+// RecordBatchOperation creates, updates or deletes a record. A create fails if the record exists and an update fails
+// if it doesn't. A delete only needs the name and, optionally, the type and routing policy set identifier to narrow
+// down which of the records with that name are deleted.
+type RecordBatchOperation struct {
+	Action string `json:"action,omitempty"`
+	RecordRequest
+}
+
+type RecordBatchResponse struct {
+	Results []RecordBatchResult `json:"results"`
+}
+
+type RecordBatchResult struct {
+	Action string          `json:"action,omitempty"`
+	Status int             `json:"status,omitempty"`
+	Record *RecordResponse `json:"record,omitempty"`
+	// Deleted lists the records removed by a delete
+	Deleted []FQDNTypePair `json:"deleted,omitempty"`
+	Error   string         `json:"error,omitempty"`
 }
 
 type RecordResponse struct {
 	RecordRequest
 	FQDN string `json:"fqdn,omitempty"`
+	ETag string `json:"etag,omitempty"`
+}
+
+const (
+	NameRuleKindSlug  = "slug"
+	NameRuleKindLabel = "label"
+)
+
+// NameRule denies the domain slugs or record labels, depending on its kind, that equal its pattern or, if it's a regular
+// expression, match it. Regular expressions aren't anchored, so they match anywhere unless they use ^ and $.
+type NameRule struct {
+	ID      uint   `json:"id,omitempty"`
+	Kind    string `json:"kind,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	Regex   bool   `json:"regex,omitempty"`
 }
 
 type ErrorResponse struct {
@@ -54,7 +404,9 @@ type ErrorResponse struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
+// FQDNTypePair identifies a record set. SetIdentifier is only set for records that have a routing policy.
 type FQDNTypePair struct {
-	FQDN string `json:"fqdn,omitempty"`
-	Type string `json:"type,omitempty"`
+	FQDN          string `json:"fqdn,omitempty"`
+	Type          string `json:"type,omitempty"`
+	SetIdentifier string `json:"setIdentifier,omitempty"`
 }
@@ -0,0 +1,149 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// MXValue is the parsed form of an MX record value: "<priority> <target>"
+type MXValue struct {
+	Priority uint16
+	Target   string
+}
+
+func (v MXValue) String() string {
+	return fmt.Sprintf("%d %s", v.Priority, v.Target)
+}
+
+// SRVValue is the parsed form of an SRV record value: "<priority> <weight> <port> <target>"
+type SRVValue struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+func (v SRVValue) String() string {
+	return fmt.Sprintf("%d %d %d %s", v.Priority, v.Weight, v.Port, v.Target)
+}
+
+// CAAValue is the parsed form of a CAA record value: "<flags> <tag> <value>". The value may optionally be quoted.
+type CAAValue struct {
+	Flags uint8
+	Tag   string
+	Value string
+}
+
+// String returns the value in presentation format, which always quotes the value
+func (v CAAValue) String() string {
+	return fmt.Sprintf("%d %s \"%s\"", v.Flags, v.Tag, v.Value)
+}
+
+func ParseMXValue(value string) (MXValue, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return MXValue{}, fmt.Errorf("expected \"<priority> <target>\"")
+	}
+
+	priority, err := parseUint16("priority", fields[0])
+	if err != nil {
+		return MXValue{}, err
+	}
+
+	// A lone "." is the null MX (RFC 7505), used to state that a name accepts no mail
+	if fields[1] != "." {
+		if err := ValidateHostname(fields[1]); err != nil {
+			return MXValue{}, err
+		}
+	}
+
+	return MXValue{Priority: priority, Target: fields[1]}, nil
+}
+
+func ParseSRVValue(value string) (SRVValue, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 4 {
+		return SRVValue{}, fmt.Errorf("expected \"<priority> <weight> <port> <target>\"")
+	}
+
+	priority, err := parseUint16("priority", fields[0])
+	if err != nil {
+		return SRVValue{}, err
+	}
+	weight, err := parseUint16("weight", fields[1])
+	if err != nil {
+		return SRVValue{}, err
+	}
+	port, err := parseUint16("port", fields[2])
+	if err != nil {
+		return SRVValue{}, err
+	}
+
+	// A lone "." means the service is decidedly not available at this name (RFC 2782)
+	if fields[3] != "." {
+		if err := ValidateHostname(fields[3]); err != nil {
+			return SRVValue{}, err
+		}
+	}
+
+	return SRVValue{Priority: priority, Weight: weight, Port: port, Target: fields[3]}, nil
+}
+
+func ParseCAAValue(value string) (CAAValue, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 3 {
+		return CAAValue{}, fmt.Errorf("expected \"<flags> <tag> <value>\"")
+	}
+
+	// The value is everything after the tag, since it may contain whitespace of its own
+	rest := strings.TrimSpace(value)
+	for _, f := range fields[:2] {
+		rest = strings.TrimLeftFunc(strings.TrimPrefix(rest, f), unicode.IsSpace)
+	}
+
+	flags, err := strconv.ParseUint(fields[0], 10, 8)
+	if err != nil {
+		return CAAValue{}, fmt.Errorf("flags must be a number between 0 and 255")
+	}
+
+	// Tags are limited to ASCII letters and numbers (RFC 8659, section 4.1)
+	tag := fields[1]
+	if tag == "" || len(tag) > 15 {
+		return CAAValue{}, fmt.Errorf("tag must be between 1 and 15 characters")
+	}
+	for _, c := range tag {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return CAAValue{}, fmt.Errorf("tag %v must contain only letters and numbers", tag)
+		}
+	}
+
+	v := rest
+	if len(v) >= 2 && strings.HasPrefix(v, "\"") && strings.HasSuffix(v, "\"") {
+		v = v[1 : len(v)-1]
+	}
+	if strings.Contains(v, "\"") {
+		return CAAValue{}, fmt.Errorf("value must not contain quotes")
+	}
+
+	return CAAValue{Flags: uint8(flags), Tag: tag, Value: v}, nil
+}
+
+func parseUint16(name, value string) (uint16, error) {
+	i, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%v must be a number between 0 and 65535", name)
+	}
+	return uint16(i), nil
+}
+
+// ValidateHostname returns an error if name isn't a valid hostname. A trailing "." is allowed.
+func ValidateHostname(name string) error {
+	if errs := validation.IsDNS1123Subdomain(strings.ToLower(strings.TrimSuffix(name, "."))); len(errs) > 0 {
+		return fmt.Errorf("%v is not a valid hostname: %v", name, strings.Join(errs, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package model
+
+import "testing"
+
+func TestParseMXValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    MXValue
+		wantErr bool
+	}{
+		{name: "valid", value: "10 mail.example.com", want: MXValue{Priority: 10, Target: "mail.example.com"}},
+		{name: "trailing dot", value: "10 mail.example.com.", want: MXValue{Priority: 10, Target: "mail.example.com."}},
+		{name: "repeated whitespace", value: " 10 \t mail.example.com ", want: MXValue{Priority: 10, Target: "mail.example.com"}},
+		{name: "null mx", value: "0 .", want: MXValue{Priority: 0, Target: "."}},
+		{name: "missing target", value: "10", wantErr: true},
+		{name: "extra field", value: "10 mail.example.com extra", wantErr: true},
+		{name: "priority not a number", value: "ten mail.example.com", wantErr: true},
+		{name: "priority too large", value: "65536 mail.example.com", wantErr: true},
+		{name: "invalid target", value: "10 mail_server!", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMXValue(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMXValue(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMXValue(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSRVValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    SRVValue
+		wantErr bool
+	}{
+		{name: "valid", value: "10 20 443 sip.example.com", want: SRVValue{Priority: 10, Weight: 20, Port: 443, Target: "sip.example.com"}},
+		{name: "repeated whitespace", value: "10  20\t443   sip.example.com", want: SRVValue{Priority: 10, Weight: 20, Port: 443, Target: "sip.example.com"}},
+		{name: "service not available", value: "0 0 0 .", want: SRVValue{Target: "."}},
+		{name: "missing port", value: "10 20 sip.example.com", wantErr: true},
+		{name: "weight not a number", value: "10 x 443 sip.example.com", wantErr: true},
+		{name: "port too large", value: "10 20 70000 sip.example.com", wantErr: true},
+		{name: "invalid target", value: "10 20 443 -", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSRVValue(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSRVValue(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSRVValue(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCAAValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    CAAValue
+		wantErr bool
+	}{
+		{name: "quoted", value: `0 issue "letsencrypt.org"`, want: CAAValue{Tag: "issue", Value: "letsencrypt.org"}},
+		{name: "unquoted", value: "128 issue letsencrypt.org", want: CAAValue{Flags: 128, Tag: "issue", Value: "letsencrypt.org"}},
+		{name: "repeated whitespace", value: "  0   issue \t \"letsencrypt.org\" ", want: CAAValue{Tag: "issue", Value: "letsencrypt.org"}},
+		{name: "value with spaces", value: `0 iodef "mailto:security@example.com; extra"`, want: CAAValue{Tag: "iodef", Value: "mailto:security@example.com; extra"}},
+		{name: "value with repeated spaces", value: `0 issue "ca.example.net;  account=1"`, want: CAAValue{Tag: "issue", Value: "ca.example.net;  account=1"}},
+		{name: "empty quoted value", value: `0 issue ""`, want: CAAValue{Tag: "issue"}},
+		{name: "missing value", value: "0 issue", wantErr: true},
+		{name: "flags not a number", value: "x issue letsencrypt.org", wantErr: true},
+		{name: "flags too large", value: "256 issue letsencrypt.org", wantErr: true},
+		{name: "tag too long", value: "0 abcdefghijklmnop letsencrypt.org", wantErr: true},
+		{name: "tag with punctuation", value: "0 is-sue letsencrypt.org", wantErr: true},
+		{name: "quote inside value", value: `0 issue "lets"encrypt.org"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCAAValue(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCAAValue(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseCAAValue(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/acorn-io/acorn-dns/pkg/model"
+	"github.com/sirupsen/logrus"
+)
+
+// reservedLabels can never be used as a label of a record name, since the server relies on them itself
+var reservedLabels = []string{
+	"_psl",
+}
+
+// reservedSlugs can never be given to a domain, since the server treats the names under them specially
+var reservedSlugs = []string{
+	"local",
+}
+
+// profaneWords are rejected anywhere in a generated slug
+var profaneWords = []string{
+	"anal", "anus", "cock", "cunt", "dick", "fag", "fuck", "kkk", "nazi", "nigg", "piss", "porn", "rape", "sex", "shit",
+	"slut", "tits", "twat", "whore",
+}
+
+// leetReplacer undoes the digit substitutions that would otherwise let a profane word through
+var leetReplacer = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b")
+
+// Policy decides which slugs and record labels may be used. Its rules come from the server's configuration, and more
+// rules can be passed to each check, such as the ones operators manage through the admin API.
+type Policy struct {
+	rules []rule
+}
+
+// Rules are extra rules compiled for the checks of a Policy, so that they can be compiled once and used for any number
+// of checks
+type Rules struct {
+	rules []rule
+}
+
+type rule struct {
+	model.NameRule
+	re *regexp.Regexp
+}
+
+// New creates a policy that denies what the given rules match, on top of the built-in reserved labels
+func New(rules []model.NameRule) (*Policy, error) {
+	p := &Policy{}
+	for _, r := range rules {
+		compiled, err := compile(r)
+		if err != nil {
+			return nil, err
+		}
+		p.rules = append(p.rules, compiled)
+	}
+	return p, nil
+}
+
+// Validate checks that a rule is well-formed
+func Validate(r model.NameRule) error {
+	_, err := compile(r)
+	return err
+}
+
+// Compile compiles extra rules for the checks of a Policy. Invalid rules are left out.
+func Compile(rules []model.NameRule) Rules {
+	compiled := Rules{rules: make([]rule, 0, len(rules))}
+	for _, r := range rules {
+		c, err := compile(r)
+		if err != nil {
+			// Rules are validated before they are stored, so this only happens if one was stored some other way
+			logrus.Warnf("ignoring invalid name rule %v: %v", r.Pattern, err)
+			continue
+		}
+		compiled.rules = append(compiled.rules, c)
+	}
+	return compiled
+}
+
+// CheckSlug returns an error if a domain can't use slug, because it's reserved, a rule denies it or it's profane
+func (p *Policy) CheckSlug(slug string, extra Rules) error {
+	for _, reserved := range reservedSlugs {
+		if strings.EqualFold(slug, reserved) {
+			return fmt.Errorf("slug %v is reserved", slug)
+		}
+	}
+
+	normalized := leetReplacer.Replace(slug)
+	for _, word := range profaneWords {
+		if strings.Contains(slug, word) || strings.Contains(normalized, word) {
+			return fmt.Errorf("slug %v is not allowed", slug)
+		}
+	}
+
+	if r, ok := p.match(model.NameRuleKindSlug, slug, extra); ok {
+		return fmt.Errorf("slug %v is not allowed by rule %v", slug, r.Pattern)
+	}
+	return nil
+}
+
+// CheckRecordName returns an error if any label of a record name is reserved or denied by a rule
+func (p *Policy) CheckRecordName(name string, extra Rules) error {
+	for _, label := range strings.Split(name, ".") {
+		for _, reserved := range reservedLabels {
+			if strings.EqualFold(label, reserved) {
+				return fmt.Errorf("label %v of %v is reserved", label, name)
+			}
+		}
+
+		if r, ok := p.match(model.NameRuleKindLabel, strings.ToLower(label), extra); ok {
+			return fmt.Errorf("label %v of %v is not allowed by rule %v", label, name, r.Pattern)
+		}
+	}
+	return nil
+}
+
+// match returns the first of the policy's rules or the extra rules of the given kind that matches value
+func (p *Policy) match(kind, value string, extra Rules) (model.NameRule, bool) {
+	for _, rules := range [][]rule{p.rules, extra.rules} {
+		for _, r := range rules {
+			if r.Kind != kind {
+				continue
+			}
+			if r.re != nil && r.re.MatchString(value) || r.re == nil && strings.EqualFold(r.Pattern, value) {
+				return r.NameRule, true
+			}
+		}
+	}
+	return model.NameRule{}, false
+}
+
+func compile(r model.NameRule) (rule, error) {
+	if r.Kind != model.NameRuleKindSlug && r.Kind != model.NameRuleKindLabel {
+		return rule{}, fmt.Errorf("rule kind must be %v or %v", model.NameRuleKindSlug, model.NameRuleKindLabel)
+	}
+	if r.Pattern == "" {
+		return rule{}, fmt.Errorf("rule pattern must be provided")
+	}
+	if !r.Regex {
+		return rule{NameRule: r}, nil
+	}
+
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return rule{}, fmt.Errorf("rule pattern %v is not a valid regular expression: %v", r.Pattern, err)
+	}
+	return rule{NameRule: r, re: re}, nil
+}
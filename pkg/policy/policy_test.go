@@ -0,0 +1,110 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/acorn-io/acorn-dns/pkg/model"
+)
+
+func TestCheckSlug(t *testing.T) {
+	p, err := New([]model.NameRule{
+		{Kind: model.NameRuleKindSlug, Pattern: "admin"},
+		{Kind: model.NameRuleKindSlug, Pattern: "^acorn", Regex: true},
+		{Kind: model.NameRuleKindLabel, Pattern: "mail"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra := Compile([]model.NameRule{
+		{Kind: model.NameRuleKindSlug, Pattern: "blocked"},
+		// Invalid rules are left out rather than failing every check
+		{Kind: model.NameRuleKindSlug, Pattern: "(", Regex: true},
+		{Kind: "unknown", Pattern: "abc123"},
+	})
+
+	tests := []struct {
+		name    string
+		slug    string
+		extra   Rules
+		wantErr bool
+	}{
+		{name: "allowed", slug: "abc123"},
+		{name: "reserved", slug: "local", wantErr: true},
+		{name: "reserved in another case", slug: "LOCAL", wantErr: true},
+		{name: "profane", slug: "xporn1", wantErr: true},
+		{name: "profane with digits for letters", slug: "p0rn", wantErr: true},
+		{name: "denied by exact rule", slug: "admin", wantErr: true},
+		{name: "exact rule matches whole slug only", slug: "admins"},
+		{name: "denied by regex rule", slug: "acornx", wantErr: true},
+		{name: "regex rule not matching", slug: "xacorn"},
+		{name: "label rule doesn't apply to slugs", slug: "mail"},
+		{name: "denied by extra rule", slug: "blocked", extra: extra, wantErr: true},
+		{name: "extra rule only applies when passed", slug: "blocked"},
+		{name: "allowed with extra rules", slug: "abc123", extra: extra},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.CheckSlug(tt.slug, tt.extra)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckSlug(%q) error = %v, wantErr %v", tt.slug, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckRecordName(t *testing.T) {
+	p, err := New([]model.NameRule{
+		{Kind: model.NameRuleKindLabel, Pattern: "internal"},
+		{Kind: model.NameRuleKindLabel, Pattern: "^adm[0-9]+$", Regex: true},
+		{Kind: model.NameRuleKindSlug, Pattern: "www"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra := Compile([]model.NameRule{{Kind: model.NameRuleKindLabel, Pattern: "secret"}})
+
+	tests := []struct {
+		name    string
+		record  string
+		extra   Rules
+		wantErr bool
+	}{
+		{name: "allowed", record: "www"},
+		{name: "allowed with several labels", record: "a.b.c"},
+		{name: "reserved label", record: "_psl", wantErr: true},
+		{name: "reserved label deeper in name", record: "x._PSL.y", wantErr: true},
+		{name: "denied by exact rule", record: "internal", wantErr: true},
+		{name: "exact rule is case insensitive", record: "api.Internal", wantErr: true},
+		{name: "denied by regex rule", record: "adm12.www", wantErr: true},
+		{name: "regex rule sees lowercased labels", record: "ADM1", wantErr: true},
+		{name: "regex rule not matching", record: "adm", extra: extra},
+		{name: "denied by extra rule", record: "x.secret", extra: extra, wantErr: true},
+		{name: "extra rule only applies when passed", record: "x.secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.CheckRecordName(tt.record, tt.extra)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckRecordName(%q) error = %v, wantErr %v", tt.record, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule model.NameRule
+	}{
+		{name: "unknown kind", rule: model.NameRule{Kind: "zone", Pattern: "x"}},
+		{name: "empty pattern", rule: model.NameRule{Kind: model.NameRuleKindSlug}},
+		{name: "invalid regex", rule: model.NameRule{Kind: model.NameRuleKindLabel, Pattern: "[", Regex: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New([]model.NameRule{tt.rule}); err == nil {
+				t.Errorf("New(%+v) succeeded, want an error", tt.rule)
+			}
+		})
+	}
+}